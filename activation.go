@@ -0,0 +1,279 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busMethodStartServiceByName = busDest + ".StartServiceByName"
+	busSignalNameOwnerChanged   = busDest + ".NameOwnerChanged"
+
+	busErrorServiceUnknown = busDest + ".Error.ServiceUnknown"
+	busErrorNoReply        = busDest + ".Error.NoReply"
+	busErrorTimeout        = busDest + ".Error.Timeout"
+	busErrorSpawnPrefix    = busDest + ".Error.Spawn."
+
+	propertiesGetAll = "org.freedesktop.DBus.Properties.GetAll"
+	introspectMethod = "org.freedesktop.DBus.Introspectable.Introspect"
+
+	// DefaultActivationTimeout is the time to wait for the secret service to
+	// appear on the bus
+	DefaultActivationTimeout = 30 * time.Second
+
+	// DefaultActivationRetries is the number of times a call is retried
+	DefaultActivationRetries = 5
+
+	// DefaultActivationBackoff is the delay before the first retry. It is
+	// doubled for every retry up to DefaultActivationMaxBackoff
+	DefaultActivationBackoff = 100 * time.Millisecond
+
+	// DefaultActivationMaxBackoff is the maximum delay between retries
+	DefaultActivationMaxBackoff = 5 * time.Second
+)
+
+// idempotentMethods are the methods that are retried if the call may have
+// reached the secret service before failing
+var idempotentMethods = map[string]bool{
+	propertiesGet:               true,
+	propertiesGetAll:            true,
+	introspectMethod:            true,
+	serviceMethodSearchItems:    true,
+	serviceMethodGetSecrets:     true,
+	serviceMethodReadAlias:      true,
+	collectionMethodSearchItems: true,
+	itemMethodGetSecret:         true,
+}
+
+// ActivationOptions configures how the secret service is activated and how
+// calls failing because the service is not (yet) available are retried
+type ActivationOptions struct {
+	// Start activates the secret service using StartServiceByName. If false,
+	// the secret service is expected to be started by someone else
+	Start bool
+
+	// Timeout is the time to wait for the secret service to appear on the
+	// bus. Defaults to DefaultActivationTimeout
+	Timeout time.Duration
+
+	// Retries is the number of times a call is retried. Defaults to
+	// DefaultActivationRetries
+	Retries int
+
+	// Backoff is the delay before the first retry. Defaults to
+	// DefaultActivationBackoff
+	Backoff time.Duration
+
+	// MaxBackoff is the maximum delay between retries. Defaults to
+	// DefaultActivationMaxBackoff
+	MaxBackoff time.Duration
+}
+
+// withDefaults returns a copy of opts with defaults applied
+func (opts ActivationOptions) withDefaults() ActivationOptions {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultActivationTimeout
+	}
+	if opts.Retries <= 0 {
+		opts.Retries = DefaultActivationRetries
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultActivationBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultActivationMaxBackoff
+	}
+
+	return opts
+}
+
+// ActivateSecretService waits until the secret service is available on conn,
+// starting it if opts.Start is set, and returns a client whose calls are
+// retried with backoff while the service is being activated
+func ActivateSecretService(ctx context.Context, conn *dbus.Conn, opts ActivationOptions) (SecretService, error) {
+	return activateSecretService(ctx, conn, opts)
+}
+
+// activateSecretService implements ActivateSecretService for any busConn
+func activateSecretService(ctx context.Context, conn busConn, opts ActivationOptions) (SecretService, error) {
+	ac := &activatingConn{
+		connWrapper: connWrapper{conn},
+		opts:        opts.withDefaults(),
+	}
+
+	if err := ac.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return newSecretService(ac)
+}
+
+// WaitForSecretService waits until SecretServiceDest has an owner on conn. If
+// start is set, StartServiceByName is used to activate the service
+func WaitForSecretService(ctx context.Context, conn *dbus.Conn, start bool, timeout time.Duration) error {
+	ac := &activatingConn{
+		connWrapper: connWrapper{conn},
+		opts: ActivationOptions{
+			Start:   start,
+			Timeout: timeout,
+		}.withDefaults(),
+	}
+
+	return ac.wait(ctx)
+}
+
+// activatingConn is a busConn that activates the secret service and retries
+// calls while it is not available
+type activatingConn struct {
+	connWrapper
+	opts ActivationOptions
+}
+
+// Object returns the object identified by dest and path. Calls to objects of
+// the secret service are retried
+func (ac *activatingConn) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	obj := ac.busConn.Object(dest, path)
+	if dest != SecretServiceDest {
+		return obj
+	}
+
+	o := &activatingObject{conn: ac}
+	o.busObject = busObject{obj, o.CallWithContext}
+
+	return o
+}
+
+// wait waits until SecretServiceDest has an owner
+func (ac *activatingConn) wait(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, ac.opts.Timeout)
+	defer cancel()
+
+	// subscribe before checking the owner to not miss the signal
+	match := nameOwnerChangedMatch()
+	if err := ac.busConn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer ac.busConn.RemoveMatchSignal(match...)
+
+	sig := make(chan *dbus.Signal, 10)
+	ac.busConn.Signal(sig)
+	defer ac.busConn.RemoveSignal(sig)
+
+	bus := ac.busConn.Object(busDest, busPath)
+
+	var owner string
+	err := bus.CallWithContext(ctx, busMethodGetNameOwner, 0, SecretServiceDest).Store(&owner)
+	if err == nil {
+		return nil
+	}
+	if !isDBusError(err, busErrorNameHasNoOwner) {
+		return err
+	}
+
+	if ac.opts.Start {
+		var result uint32
+		err := bus.CallWithContext(ctx, busMethodStartServiceByName, 0, SecretServiceDest, uint32(0)).Store(&result)
+		if err == nil {
+			return nil
+		}
+
+		// the service is not activatable, wait for it to be started
+		if !isDBusError(err, busErrorServiceUnknown) {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("%s did not appear on the bus within %s", SecretServiceDest, ac.opts.Timeout)
+			}
+			return ctx.Err()
+
+		case s, ok := <-sig:
+			if !ok {
+				return dbus.ErrClosed
+			}
+
+			if owner, ok := parseNameOwnerChanged(s); ok && owner != "" {
+				return nil
+			}
+		}
+	}
+}
+
+// activatingObject retries calls failing because the secret service is not
+// available
+type activatingObject struct {
+	busObject
+	conn *activatingConn
+}
+
+// CallWithContext implements dbus.BusObject. Calls that did not reach the
+// secret service are always retried while calls that may have reached it are
+// only retried for idempotent methods
+func (o *activatingObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	backoff := o.conn.opts.Backoff
+
+	for attempt := 0; ; attempt++ {
+		call := o.BusObject.CallWithContext(ctx, method, flags, args...)
+		if call.Err == nil || attempt >= o.conn.opts.Retries {
+			return call
+		}
+
+		undelivered := isNotActivated(call.Err)
+		if !undelivered && !(isTransient(call.Err) && idempotentMethods[method]) {
+			return call
+		}
+
+		if undelivered {
+			if err := o.conn.wait(ctx); err != nil {
+				return call
+			}
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &dbus.Call{Err: ctx.Err()}
+		case <-timer.C:
+		}
+
+		backoff *= 2
+		if backoff > o.conn.opts.MaxBackoff {
+			backoff = o.conn.opts.MaxBackoff
+		}
+	}
+}
+
+// isNotActivated returns true if err indicates that a call did not reach the
+// secret service because it is not running or its activation failed
+func isNotActivated(err error) bool {
+	if isDBusError(err, busErrorServiceUnknown) || isDBusError(err, busErrorNameHasNoOwner) {
+		return true
+	}
+
+	switch e := err.(type) {
+	case dbus.Error:
+		return strings.HasPrefix(e.Name, busErrorSpawnPrefix)
+	case *dbus.Error:
+		return e != nil && strings.HasPrefix(e.Name, busErrorSpawnPrefix)
+	}
+
+	return false
+}
+
+// isTransient returns true if err indicates a call that may have reached the
+// secret service but did not complete
+func isTransient(err error) bool {
+	return isDBusError(err, busErrorNoReply) || isDBusError(err, busErrorTimeout)
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// failingConn is a busConn whose secret service objects fail every call
+// with err. Calls to the bus succeed
+type failingConn struct {
+	err   error
+	calls map[string]int
+}
+
+func (c *failingConn) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	return &failingObject{conn: c, dest: dest}
+}
+
+func (c *failingConn) Signal(ch chan<- *dbus.Signal)                       {}
+func (c *failingConn) RemoveSignal(ch chan<- *dbus.Signal)                 {}
+func (c *failingConn) AddMatchSignal(options ...dbus.MatchOption) error    { return nil }
+func (c *failingConn) RemoveMatchSignal(options ...dbus.MatchOption) error { return nil }
+
+type failingObject struct {
+	dbus.BusObject
+	conn *failingConn
+	dest string
+}
+
+func (o *failingObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	if o.dest == busDest {
+		return &dbus.Call{Body: []interface{}{":1.1"}}
+	}
+
+	o.conn.calls[method]++
+	return &dbus.Call{Err: o.conn.err}
+}
+
+func TestActivationRetries(t *testing.T) {
+	const retries = 2
+
+	noReply := dbus.Error{Name: busErrorNoReply}
+	unknown := dbus.Error{Name: busErrorServiceUnknown}
+
+	cases := []struct {
+		name     string
+		err      error
+		method   string
+		expected int
+	}{
+		{
+			name:     "idempotent call that may have been delivered",
+			err:      noReply,
+			method:   itemMethodGetSecret,
+			expected: retries + 1,
+		},
+		{
+			name:     "non-idempotent call that may have been delivered",
+			err:      noReply,
+			method:   collectionMethodCreateItem,
+			expected: 1,
+		},
+		{
+			name:     "non-idempotent call that has not been delivered",
+			err:      unknown,
+			method:   collectionMethodCreateItem,
+			expected: retries + 1,
+		},
+		{
+			name:     "other errors",
+			err:      dbus.Error{Name: ErrorIsLocked},
+			method:   itemMethodGetSecret,
+			expected: 1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conn := &failingConn{err: c.err, calls: make(map[string]int)}
+			ac := &activatingConn{
+				connWrapper: connWrapper{conn},
+				opts: ActivationOptions{
+					Retries: retries,
+					Backoff: time.Millisecond,
+				}.withDefaults(),
+			}
+
+			obj := ac.Object(SecretServiceDest, "/org/freedesktop/secrets/collection/login")
+			if err := obj.Call(c.method, 0).Err; !reflect.DeepEqual(err, c.err) {
+				t.Errorf("expected %v but got %v", c.err, err)
+			}
+
+			if n := conn.calls[c.method]; n != c.expected {
+				t.Errorf("expected %d calls but got %d", c.expected, n)
+			}
+		})
+	}
+}
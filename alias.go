@@ -0,0 +1,95 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+// ListAliases returns all aliases and the path of the collection they reference.
+// Aliases are discovered by introspecting AliasesPath which is not supported
+// by all providers
+func (svc *service) ListAliases() (map[string]dbus.ObjectPath, error) {
+	node, err := introspect.Call(svc.conn.Object(SecretServiceDest, AliasesPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect %s: %s", AliasesPath, err)
+	}
+
+	aliases := make(map[string]dbus.ObjectPath, len(node.Children))
+	for _, child := range node.Children {
+		path, err := svc.ReadAlias(child.Name)
+		if err == ErrUnknownAlias {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		aliases[child.Name] = path
+	}
+
+	return aliases, nil
+}
+
+// GetCollectionByAlias returns the collection referenced by the alias
+func (svc *service) GetCollectionByAlias(name string) (Collection, error) {
+	path, err := svc.ReadAlias(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCollection(svc.conn, path)
+}
+
+// EnsureDefaultCollection returns the default collection. If the default alias
+// is not set it is assigned to the collection labeled DefaultCollectionLabel
+// which is created if required. Providers that do not support aliases return
+// the collection labeled DefaultCollectionLabel
+func (svc *service) EnsureDefaultCollection() (Collection, error) {
+	aliases := svc.supportsAliases()
+
+	if aliases {
+		col, err := svc.GetCollectionByAlias(DefaultAlias)
+		if err == nil {
+			return col, nil
+		}
+
+		if err != ErrUnknownAlias {
+			return nil, err
+		}
+	}
+
+	all, err := svc.GetAllCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range all {
+		l, err := c.GetLabel()
+		if err != nil {
+			return nil, err
+		}
+
+		if l == DefaultCollectionLabel {
+			if aliases {
+				if err := svc.SetAlias(DefaultAlias, c.Path()); err != nil {
+					return nil, err
+				}
+			}
+
+			return c, nil
+		}
+	}
+
+	alias := DefaultAlias
+	if !aliases {
+		alias = ""
+	}
+
+	return svc.CreateCollection(DefaultCollectionLabel, alias)
+}
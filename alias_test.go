@@ -0,0 +1,122 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring_test
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+func TestEnsureDefaultCollection(t *testing.T) {
+	cases := []struct {
+		name string
+
+		// prepare modifies the fake before EnsureDefaultCollection is called
+		prepare func(t *testing.T, fake *keyringfake.Service)
+
+		dismissed bool
+		created   bool
+	}{
+		{
+			name:    "alias exists",
+			prepare: func(t *testing.T, fake *keyringfake.Service) {},
+		},
+		{
+			name: "labeled collection is aliased",
+			prepare: func(t *testing.T, fake *keyringfake.Service) {
+				if err := fake.RemoveAlias(keyring.DefaultAlias); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "collection is created and aliased",
+			prepare: func(t *testing.T, fake *keyringfake.Service) {
+				col, err := fake.GetDefaultCollection()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := col.Delete(); err != nil {
+					t.Fatal(err)
+				}
+			},
+			created: true,
+		},
+		{
+			name: "create prompt is dismissed",
+			prepare: func(t *testing.T, fake *keyringfake.Service) {
+				col, err := fake.GetDefaultCollection()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := col.Delete(); err != nil {
+					t.Fatal(err)
+				}
+
+				fake.SetPromptHandler(func(dbus.ObjectPath, []dbus.ObjectPath) bool { return false })
+			},
+			dismissed: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := keyringfake.New()
+
+			c.prepare(t, fake)
+
+			bus := startBus(t, fake)
+			defer bus.Close()
+
+			client, err := keyring.Connect(keyring.ConnectOptions{Address: bus.Address})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			svc, err := client.SecretService()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			col, err := svc.EnsureDefaultCollection()
+			if c.dismissed {
+				if err != keyring.ErrPromptDismissed {
+					t.Errorf("expected ErrPromptDismissed but got %v", err)
+				}
+
+				if _, err := fake.ReadAlias(keyring.DefaultAlias); err != keyring.ErrUnknownAlias {
+					t.Errorf("expected the alias to be unset but got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if label, err := col.GetLabel(); err != nil || label != keyring.DefaultCollectionLabel {
+				t.Errorf("expected the collection %q but got %q (%v)", keyring.DefaultCollectionLabel, label, err)
+			}
+
+			// creating a collection requires a prompt
+			if created := fake.PromptCount() > 0; created != c.created {
+				t.Errorf("expected created to be %t", c.created)
+			}
+
+			if path, err := fake.ReadAlias(keyring.DefaultAlias); err != nil || path != col.Path() {
+				t.Errorf("expected the alias to point to %s but got %s (%v)", col.Path(), path, err)
+			}
+
+			if all, _ := fake.GetAllCollections(); len(all) != 1 {
+				t.Errorf("expected a single collection but got %d", len(all))
+			}
+		})
+	}
+}
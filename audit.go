@@ -0,0 +1,342 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// AuditOperation is an operation recorded by an AuditSink
+type AuditOperation string
+
+// Audited operations
+const (
+	AuditGetSecret  AuditOperation = "GetSecret"
+	AuditGetSecrets AuditOperation = "GetSecrets"
+	AuditSetSecret  AuditOperation = "SetSecret"
+	AuditCreateItem AuditOperation = "CreateItem"
+	AuditDelete     AuditOperation = "Delete"
+)
+
+// auditedMethods maps the audited DBus methods to their operations
+var auditedMethods = map[string]AuditOperation{
+	itemMethodGetSecret:        AuditGetSecret,
+	serviceMethodGetSecrets:    AuditGetSecrets,
+	itemMethodSetSecret:        AuditSetSecret,
+	collectionMethodCreateItem: AuditCreateItem,
+	itemMethodDelete:           AuditDelete,
+}
+
+// AuditCaller identifies the process performing an audited operation
+type AuditCaller struct {
+	PID        int    `json:"pid"`
+	UID        int    `json:"uid"`
+	Executable string `json:"executable,omitempty"`
+
+	// Component is the application defined name of the caller
+	// (see AuditOptions)
+	Component string `json:"component,omitempty"`
+}
+
+// AuditRecord describes a single audited operation. Secret values are never
+// part of a record
+type AuditRecord struct {
+	Time      time.Time      `json:"time"`
+	Operation AuditOperation `json:"operation"`
+
+	// Path is the object path of the item. For CreateItem it is "/" if the
+	// item is created after a prompt or the operation is recorded in strict
+	// mode
+	Path dbus.ObjectPath `json:"path"`
+
+	// Collection is the collection of a new item. Only set for CreateItem
+	Collection dbus.ObjectPath `json:"collection,omitempty"`
+
+	Label      string            `json:"label,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Caller     AuditCaller       `json:"caller"`
+
+	// Error is set if the operation failed
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink records audited operations
+type AuditSink interface {
+	Record(r *AuditRecord) error
+}
+
+// AuditOptions configures auditing
+type AuditOptions struct {
+	// Sink records the audited operations
+	Sink AuditSink
+
+	// Component is recorded as AuditCaller.Component
+	Component string
+
+	// Strict fails operations that cannot be recorded. Secrets read by such
+	// operations are not returned. Operations modifying the secret service
+	// are recorded before they are performed and skipped if the record
+	// cannot be written. If they fail, a second record with the error is
+	// written
+	Strict bool
+}
+
+// AuditSecretService returns a client to the SecretService on conn that
+// records all reads and writes of secrets to opts.Sink
+func AuditSecretService(conn *dbus.Conn, opts AuditOptions) (SecretService, error) {
+	return newSecretService(newAuditingConn(conn, opts))
+}
+
+// auditingConn is a busConn that records reads and writes of secrets
+type auditingConn struct {
+	connWrapper
+	opts   AuditOptions
+	caller AuditCaller
+}
+
+// newAuditingConn returns an auditingConn for conn
+func newAuditingConn(conn busConn, opts AuditOptions) *auditingConn {
+	caller := AuditCaller{
+		PID:       os.Getpid(),
+		UID:       os.Getuid(),
+		Component: opts.Component,
+	}
+
+	if exe, err := os.Executable(); err == nil {
+		caller.Executable = exe
+	}
+
+	return &auditingConn{
+		connWrapper: connWrapper{conn},
+		opts:        opts,
+		caller:      caller,
+	}
+}
+
+// Object returns the object identified by dest and path. Calls to objects of
+// the secret service are audited
+func (ac *auditingConn) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	obj := ac.busConn.Object(dest, path)
+	if dest != SecretServiceDest {
+		return obj
+	}
+
+	o := &auditedObject{conn: ac}
+	o.busObject = busObject{obj, o.CallWithContext}
+
+	return o
+}
+
+// itemDescription is the label and the attributes of an item
+type itemDescription struct {
+	label string
+	attrs map[string]string
+}
+
+// describe returns the labels and attributes of the items at paths. The
+// properties of all items are requested concurrently
+func (ac *auditingConn) describe(ctx context.Context, paths ...dbus.ObjectPath) []itemDescription {
+	done := make(chan *dbus.Call, len(paths))
+	calls := make([]*dbus.Call, len(paths))
+	for idx, p := range paths {
+		calls[idx] = ac.busConn.Object(SecretServiceDest, p).GoWithContext(ctx, propertiesGetAll, 0, done, ItemInterface)
+	}
+
+	for range paths {
+		<-done
+	}
+
+	result := make([]itemDescription, len(paths))
+	for idx, call := range calls {
+		var props map[string]dbus.Variant
+		if err := call.Store(&props); err != nil {
+			continue
+		}
+
+		result[idx].label, _ = props["Label"].Value().(string)
+		result[idx].attrs, _ = props["Attributes"].Value().(map[string]string)
+	}
+
+	return result
+}
+
+// auditedObject records calls of audited methods
+type auditedObject struct {
+	busObject
+	conn *auditingConn
+}
+
+// mutatingOperations are the operations that modify the secret service. In
+// strict mode they are recorded before they are performed
+var mutatingOperations = map[AuditOperation]bool{
+	AuditSetSecret:  true,
+	AuditCreateItem: true,
+	AuditDelete:     true,
+}
+
+// CallWithContext implements dbus.BusObject
+func (o *auditedObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	op, ok := auditedMethods[method]
+	if !ok {
+		return o.BusObject.CallWithContext(ctx, method, flags, args...)
+	}
+
+	var records []*AuditRecord
+	newRecords := func(paths ...dbus.ObjectPath) {
+		for idx, d := range o.conn.describe(ctx, paths...) {
+			records = append(records, &AuditRecord{
+				Time:       time.Now(),
+				Operation:  op,
+				Path:       paths[idx],
+				Label:      d.label,
+				Attributes: d.attrs,
+				Caller:     o.conn.caller,
+			})
+		}
+	}
+
+	switch op {
+	case AuditGetSecrets:
+		if len(args) > 0 {
+			paths, _ := args[0].([]dbus.ObjectPath)
+			newRecords(paths...)
+		}
+
+	case AuditCreateItem:
+		r := &AuditRecord{
+			Time:       time.Now(),
+			Operation:  op,
+			Path:       "/",
+			Collection: o.Path(),
+			Caller:     o.conn.caller,
+		}
+		if len(args) > 0 {
+			props, _ := args[0].(map[string]dbus.Variant)
+			r.Label, _ = props[itemPropLabel].Value().(string)
+			r.Attributes, _ = props[itemPropAttributes].Value().(map[string]string)
+		}
+		records = append(records, r)
+
+	case AuditDelete:
+		// the item is gone afterwards
+		newRecords(o.Path())
+
+	case AuditSetSecret:
+		if o.conn.opts.Strict {
+			newRecords(o.Path())
+		}
+	}
+
+	if o.conn.opts.Strict && mutatingOperations[op] {
+		return o.callRecorded(ctx, records, method, flags, args...)
+	}
+
+	call := o.BusObject.CallWithContext(ctx, method, flags, args...)
+
+	switch op {
+	case AuditGetSecret, AuditSetSecret:
+		newRecords(o.Path())
+
+	case AuditCreateItem:
+		if call.Err == nil && len(call.Body) > 0 {
+			records[0].Path, _ = call.Body[0].(dbus.ObjectPath)
+		}
+	}
+
+	for _, r := range records {
+		if call.Err != nil {
+			r.Error = call.Err.Error()
+		}
+
+		if err := o.conn.opts.Sink.Record(r); err != nil && o.conn.opts.Strict {
+			call.Err = fmt.Errorf("failed to record audit log: %s", err)
+			call.Body = nil
+		}
+	}
+
+	return call
+}
+
+// callRecorded writes records before performing the call so that no
+// modification goes unrecorded. The call is not performed if a record cannot
+// be written. If the call fails, the records are written again with the error
+func (o *auditedObject) callRecorded(ctx context.Context, records []*AuditRecord, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	for _, r := range records {
+		if err := o.conn.opts.Sink.Record(r); err != nil {
+			return &dbus.Call{
+				Destination: o.Destination(),
+				Path:        o.Path(),
+				Method:      method,
+				Args:        args,
+				Err:         fmt.Errorf("failed to record audit log: %s", err),
+			}
+		}
+	}
+
+	call := o.BusObject.CallWithContext(ctx, method, flags, args...)
+	if call.Err == nil {
+		return call
+	}
+
+	for _, r := range records {
+		r.Time = time.Now()
+		r.Error = call.Err.Error()
+		_ = o.conn.opts.Sink.Record(r)
+	}
+
+	return call
+}
+
+// JSONLinesSink is an AuditSink that writes one JSON object per record
+type JSONLinesSink struct {
+	l sync.Mutex
+	w io.Writer
+}
+
+// NewJSONLinesSink returns an AuditSink that writes records to w
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+// OpenJSONLinesSink returns an AuditSink that appends records to the file at
+// path. The file is created with mode 0600 if it does not exist
+func OpenJSONLinesSink(path string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJSONLinesSink(f), nil
+}
+
+// Record implements AuditSink
+func (s *JSONLinesSink) Record(r *AuditRecord) error {
+	blob, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	_, err = s.w.Write(append(blob, '\n'))
+	return err
+}
+
+// Close closes the underlying writer if it implements io.Closer
+func (s *JSONLinesSink) Close() error {
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JournalSocket is the native protocol socket of systemd-journald
+const JournalSocket = "/run/systemd/journal/socket"
+
+// syslog priorities used for journal records
+const (
+	journalPriorityWarning = 4
+	journalPriorityInfo    = 6
+)
+
+// JournalSink is an AuditSink that sends records to the systemd journal using
+// its native protocol. The fields of a record are stored as KEYRING_* fields
+type JournalSink struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// NewJournalSink connects to the journal. Records are logged with the
+// SYSLOG_IDENTIFIER identifier which defaults to the executable name
+func NewJournalSink(identifier string) (*JournalSink, error) {
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: JournalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &JournalSink{
+		conn:       conn,
+		identifier: identifier,
+	}, nil
+}
+
+// Record implements AuditSink
+func (s *JournalSink) Record(r *AuditRecord) error {
+	priority := journalPriorityInfo
+	message := fmt.Sprintf("keyring %s %s", r.Operation, r.Path)
+	if r.Error != "" {
+		priority = journalPriorityWarning
+		message += ": " + r.Error
+	}
+
+	buf := new(bytes.Buffer)
+	writeJournalField(buf, "MESSAGE", message)
+	writeJournalField(buf, "PRIORITY", strconv.Itoa(priority))
+	writeJournalField(buf, "SYSLOG_IDENTIFIER", s.identifier)
+	writeJournalField(buf, "KEYRING_OPERATION", string(r.Operation))
+	writeJournalField(buf, "KEYRING_PATH", string(r.Path))
+	writeJournalField(buf, "KEYRING_TIME", r.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"))
+	writeJournalField(buf, "KEYRING_CALLER_PID", strconv.Itoa(r.Caller.PID))
+	writeJournalField(buf, "KEYRING_CALLER_UID", strconv.Itoa(r.Caller.UID))
+
+	optional := map[string]string{
+		"KEYRING_COLLECTION":        string(r.Collection),
+		"KEYRING_LABEL":             r.Label,
+		"KEYRING_CALLER_EXECUTABLE": r.Caller.Executable,
+		"KEYRING_CALLER_COMPONENT":  r.Caller.Component,
+		"KEYRING_ERROR":             r.Error,
+	}
+
+	if len(r.Attributes) > 0 {
+		blob, err := json.Marshal(r.Attributes)
+		if err != nil {
+			return err
+		}
+		optional["KEYRING_ATTRIBUTES"] = string(blob)
+	}
+
+	keys := make([]string, 0, len(optional))
+	for k := range optional {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if optional[k] != "" {
+			writeJournalField(buf, k, optional[k])
+		}
+	}
+
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+// Close closes the connection to the journal
+func (s *JournalSink) Close() error {
+	return s.conn.Close()
+}
+
+// writeJournalField writes a field in the native journal protocol format.
+// Values containing newlines use the binary length-prefixed form
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
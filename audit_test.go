@@ -0,0 +1,208 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+// memorySink keeps all records in memory or fails with err if set
+type memorySink struct {
+	l       sync.Mutex
+	err     error
+	records []keyring.AuditRecord
+}
+
+func (s *memorySink) Record(r *keyring.AuditRecord) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	s.records = append(s.records, *r)
+	return nil
+}
+
+// newAuditedService serves a fake holding the items db and api on a private
+// bus and returns an audited client for it
+func newAuditedService(t *testing.T, opts keyring.AuditOptions) (*keyringfake.Service, keyring.SecretService, func()) {
+	t.Helper()
+
+	fake := keyringfake.New()
+	session, err := fake.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := fake.GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"db", "api"} {
+		if _, err := col.CreateItem(session.Path(), name, map[string]string{"service": name}, keyring.SecretValue("hunter2"), "text/plain", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bus := startBus(t, fake)
+
+	client, err := keyring.Connect(keyring.ConnectOptions{
+		Address: bus.Address,
+		Audit:   &opts,
+	})
+	if err != nil {
+		bus.Close()
+		t.Fatal(err)
+	}
+
+	svc, err := client.SecretService()
+	if err != nil {
+		client.Close()
+		bus.Close()
+		t.Fatal(err)
+	}
+
+	return fake, svc, func() {
+		client.Close()
+		bus.Close()
+	}
+}
+
+// findItem returns the item with the service attribute name
+func findItem(t *testing.T, svc keyring.SecretService, name string) keyring.Item {
+	t.Helper()
+
+	unlocked, _, err := svc.SearchItems(map[string]string{"service": name})
+	if err != nil || len(unlocked) != 1 {
+		t.Fatalf("failed to find %s: %v", name, err)
+	}
+
+	return unlocked[0]
+}
+
+func TestAuditRecords(t *testing.T) {
+	sink := &memorySink{}
+	_, svc, done := newAuditedService(t, keyring.AuditOptions{Sink: sink, Component: "test"})
+	defer done()
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := findItem(t, svc, "db")
+	api := findItem(t, svc, "api")
+
+	if _, err := db.GetSecret(session.Path()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.GetSecrets([]dbus.ObjectPath{db.Path(), api.Path()}, session.Path()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		op    keyring.AuditOperation
+		path  dbus.ObjectPath
+		label string
+	}{
+		{keyring.AuditGetSecret, db.Path(), "db"},
+		{keyring.AuditGetSecrets, db.Path(), "db"},
+		{keyring.AuditGetSecrets, api.Path(), "api"},
+	}
+
+	if len(sink.records) != len(expected) {
+		t.Fatalf("expected %d records but got %+v", len(expected), sink.records)
+	}
+
+	for idx, e := range expected {
+		r := sink.records[idx]
+
+		if r.Operation != e.op || r.Path != e.path || r.Label != e.label || r.Attributes["service"] != e.label {
+			t.Errorf("record %d: expected %s of %s (%s) but got %+v", idx, e.op, e.path, e.label, r)
+		}
+
+		if r.Caller.PID != os.Getpid() || r.Caller.Component != "test" || r.Error != "" {
+			t.Errorf("record %d: unexpected caller or error: %+v", idx, r)
+		}
+	}
+
+	blob, err := json.Marshal(sink.records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(blob), "hunter2") {
+		t.Errorf("audit records contain a secret value: %s", blob)
+	}
+}
+
+func TestAuditStrict(t *testing.T) {
+	sink := &memorySink{}
+	fake, svc, done := newAuditedService(t, keyring.AuditOptions{Sink: sink, Strict: true})
+	defer done()
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := findItem(t, svc, "db")
+	col, err := svc.GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink.l.Lock()
+	sink.err = errors.New("disk full")
+	sink.l.Unlock()
+
+	if secret, err := db.GetSecret(session.Path()); err == nil || secret != nil {
+		t.Errorf("expected reads to fail but got %v", secret)
+	}
+
+	if err := db.SetSecret(session.Path(), keyring.SecretValue("changed"), "text/plain"); err == nil {
+		t.Errorf("expected writes to fail")
+	}
+
+	if _, err := col.CreateItem(session.Path(), "new", map[string]string{"service": "new"}, keyring.SecretValue("x"), "text/plain", false); err == nil {
+		t.Errorf("expected CreateItem to fail")
+	}
+
+	// the rejected modifications must not have been performed
+	fakeSession, err := fake.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlocked, _, err := fake.SearchItems(map[string]string{"service": "db"})
+	if err != nil || len(unlocked) != 1 {
+		t.Fatalf("failed to find db in the fake: %v", err)
+	}
+
+	secret, err := unlocked[0].GetSecret(fakeSession.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret.Value.Reveal() != "hunter2" {
+		t.Errorf("SetSecret has been performed without being recorded")
+	}
+
+	if unlocked, _, _ := fake.SearchItems(map[string]string{"service": "new"}); len(unlocked) != 0 {
+		t.Errorf("CreateItem has been performed without being recorded")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+// Command dbus-keyring-conformance checks that the secret service provider
+// on the session bus implements the Secret Service API as specified and
+// prints a pass/fail report.
+//
+// Usage:
+//
+//	dbus-keyring-conformance [-fake] [-json] [-label label] [-timeout duration]
+//
+// The checks create and delete a throwaway collection. Providers that ask
+// for confirmation, like gnome-keyring, show prompts that must be accepted
+// while the checks run. With -fake the checks run against the in-memory
+// implementation of package keyringfake served on a private bus started
+// using dbus-daemon.
+//
+// The command exits with 1 if a check failed and 2 on invalid usage.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/conformance"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+func main() {
+	fake := flag.Bool("fake", false, "run against the in-memory implementation on a private bus")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	label := flag.String("label", "", "label of the throwaway collection")
+	timeout := flag.Duration("timeout", 5*time.Minute, "time to wait for all checks including prompts")
+	signalTimeout := flag.Duration("signal-timeout", conformance.DefaultSignalTimeout, "time to wait for each signal")
+	flag.Parse()
+
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := conformance.Options{
+		Label:         *label,
+		SignalTimeout: *signalTimeout,
+	}
+
+	report, err := run(*fake, *timeout, opts)
+	if err == nil {
+		err = writeReport(report, *asJSON)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+		os.Exit(1)
+	}
+
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
+
+// run connects to the provider and runs the checks. If fake is set, a
+// keyringfake.Service is served on a private bus
+func run(fake bool, timeout time.Duration, opts conformance.Options) (*conformance.Report, error) {
+	connect := keyring.ConnectOptions{}
+
+	if fake {
+		bus, err := keyringfake.StartBus()
+		if err != nil {
+			return nil, err
+		}
+		defer bus.Close()
+
+		if err := bus.Serve(keyringfake.New()); err != nil {
+			return nil, err
+		}
+
+		connect.Address = bus.Address
+		connect.Private = true
+	}
+
+	client, err := keyring.Connect(connect)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	svc, err := client.SecretService()
+	if err != nil {
+		return nil, err
+	}
+	opts.Conn = client.Conn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return conformance.Run(ctx, svc, opts), nil
+}
+
+// writeReport prints report to stdout
+func writeReport(report *conformance.Report, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	return report.WriteText(os.Stdout)
+}
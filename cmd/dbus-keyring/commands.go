@@ -0,0 +1,609 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+var collectionsCmd = &command{
+	name: "collections",
+	args: "[-output format]",
+	help: "list all collections",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		format := outputFlag(fs)
+
+		return func(args []string) error {
+			if len(args) != 0 || checkFormat(*format) != nil {
+				return errUsage
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			all, err := svc.GetAllCollections()
+			if err != nil {
+				return err
+			}
+
+			infos := make([]*collectionInfo, len(all))
+			for idx, c := range all {
+				if infos[idx], err = newCollectionInfo(c); err != nil {
+					return err
+				}
+			}
+
+			return printCollections(os.Stdout, *format, infos)
+		}
+	},
+}
+
+var itemsCmd = &command{
+	name: "items",
+	args: "[-collection label] [-output format] [-with-secret]",
+	help: "list all items of a collection",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		collection := fs.String("collection", "", "label of the collection (defaults to the default collection)")
+		format := outputFlag(fs)
+		withSecret := fs.Bool("with-secret", false, "include the secret values of unlocked items")
+
+		return func(args []string) error {
+			if len(args) != 0 || checkFormat(*format) != nil {
+				return errUsage
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			col, err := findCollection(svc, *collection)
+			if err != nil {
+				return err
+			}
+
+			items, err := col.GetAllItems()
+			if err != nil {
+				return err
+			}
+
+			infos, err := loadItemInfos(svc, items, *withSecret)
+			if err != nil {
+				return err
+			}
+
+			return printItems(os.Stdout, *format, infos)
+		}
+	},
+}
+
+var getCmd = &command{
+	name: "get",
+	args: "[-collection label] [-output format] <item-label>",
+	help: "print the secret of an item",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		collection := fs.String("collection", "", "label of the collection (defaults to the default collection)")
+		newline := fs.Bool("n", false, "append a newline to the secret")
+		format := fs.String("output", outputRaw, "output format: raw, json, yaml or table")
+
+		return func(args []string) error {
+			if len(args) != 1 {
+				return errUsage
+			}
+
+			if *format != outputRaw && checkFormat(*format) != nil {
+				return errUsage
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			col, err := findCollection(svc, *collection)
+			if err != nil {
+				return err
+			}
+
+			item, err := col.GetItem(args[0])
+			if err != nil {
+				return err
+			}
+
+			session, err := svc.OpenSession()
+			if err != nil {
+				return err
+			}
+			defer session.Close()
+
+			secret, err := item.GetSecret(session.Path())
+			if err != nil {
+				return err
+			}
+
+			if *format != outputRaw {
+				info, err := newItemInfo(item, secret)
+				if err != nil {
+					return err
+				}
+
+				if *format == outputTable {
+					return printItems(os.Stdout, *format, []*itemInfo{info})
+				}
+
+				return encode(os.Stdout, *format, info)
+			}
+
+			os.Stdout.Write(secret.Value.Bytes())
+			if *newline {
+				fmt.Println()
+			}
+
+			return nil
+		}
+	},
+}
+
+var setCmd = &command{
+	name: "set",
+	args: "[-collection label] [-attr key=value]... [-content-type type] <item-label>",
+	help: "create or update an item with the secret read from stdin",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		collection := fs.String("collection", "", "label of the collection (defaults to the default collection)")
+		contentType := fs.String("content-type", "text/plain", "content type of the secret")
+		attrs := attrFlag{}
+		fs.Var(attrs, "attr", "attribute of the item as key=value. May be repeated. If set, the item is looked up by its attributes")
+
+		return func(args []string) error {
+			if len(args) != 1 {
+				return errUsage
+			}
+			label := args[0]
+
+			secret, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			col, err := findCollection(svc, *collection)
+			if err != nil {
+				return err
+			}
+
+			session, err := svc.OpenSession()
+			if err != nil {
+				return err
+			}
+			defer session.Close()
+
+			if len(attrs) > 0 {
+				_, err := col.Upsert(session.Path(), attrs, label, secret, *contentType)
+				return err
+			}
+
+			item, err := col.GetItem(label)
+			if err == keyring.ErrNoSuchItem {
+				_, err = col.CreateItem(session.Path(), label, map[string]string{}, secret, *contentType, false)
+				return err
+			}
+
+			if err != nil {
+				return err
+			}
+
+			return item.SetSecret(session.Path(), secret, *contentType)
+		}
+	},
+}
+
+var deleteCmd = &command{
+	name: "delete",
+	args: "[-collection label] <item-label>",
+	help: "delete an item",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		collection := fs.String("collection", "", "label of the collection (defaults to the default collection)")
+
+		return func(args []string) error {
+			if len(args) != 1 {
+				return errUsage
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			col, err := findCollection(svc, *collection)
+			if err != nil {
+				return err
+			}
+
+			item, err := col.GetItem(args[0])
+			if err != nil {
+				return err
+			}
+
+			return item.Delete()
+		}
+	},
+}
+
+var searchCmd = &command{
+	name: "search",
+	args: "-attr key=value [-attr key=value]... [-output format] [-with-secret]",
+	help: "search items in all collections",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		attrs := attrFlag{}
+		fs.Var(attrs, "attr", "attribute to search for as key=value. May be repeated")
+		format := outputFlag(fs)
+		withSecret := fs.Bool("with-secret", false, "include the secret values of unlocked items")
+
+		return func(args []string) error {
+			if len(args) != 0 || len(attrs) == 0 || checkFormat(*format) != nil {
+				return errUsage
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			unlocked, locked, err := svc.SearchItems(attrs)
+			if err != nil {
+				return err
+			}
+
+			all := append(unlocked, locked...)
+			if len(all) == 0 {
+				return keyring.ErrNoSuchItem
+			}
+
+			infos, err := loadItemInfos(svc, all, *withSecret)
+			if err != nil {
+				return err
+			}
+
+			return printItems(os.Stdout, *format, infos)
+		}
+	},
+}
+
+var lockCmd = &command{
+	name: "lock",
+	args: "[collection-label]",
+	help: "lock a collection",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		return func(args []string) error {
+			return lockOrUnlock(args, true)
+		}
+	},
+}
+
+var unlockCmd = &command{
+	name: "unlock",
+	args: "[collection-label]",
+	help: "unlock a collection",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		return func(args []string) error {
+			return lockOrUnlock(args, false)
+		}
+	},
+}
+
+var aliasCmd = &command{
+	name: "alias",
+	args: "[-d] [-output format] [alias [collection-label]]",
+	help: "list, show, set or delete aliases",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		remove := fs.Bool("d", false, "delete the alias")
+		format := outputFlag(fs)
+
+		return func(args []string) error {
+			if checkFormat(*format) != nil {
+				return errUsage
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			switch {
+			case *remove:
+				if len(args) != 1 {
+					return errUsage
+				}
+				return svc.RemoveAlias(args[0])
+
+			case len(args) == 0:
+				aliases, err := svc.ListAliases()
+				if err != nil {
+					return err
+				}
+
+				names := make([]string, 0, len(aliases))
+				for name := range aliases {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				infos := make([]*aliasInfo, len(names))
+				for idx, name := range names {
+					infos[idx] = &aliasInfo{
+						Name:       name,
+						Collection: string(aliases[name]),
+					}
+				}
+
+				return printAliases(os.Stdout, *format, infos)
+
+			case len(args) == 1:
+				path, err := svc.ReadAlias(args[0])
+				if err != nil {
+					return err
+				}
+
+				return printAliases(os.Stdout, *format, []*aliasInfo{{
+					Name:       args[0],
+					Collection: string(path),
+				}})
+
+			case len(args) == 2:
+				col, err := svc.GetCollection(args[1])
+				if err != nil {
+					return err
+				}
+
+				return svc.SetAlias(args[0], col.Path())
+			}
+
+			return errUsage
+		}
+	},
+}
+
+var runCmd = &command{
+	name: "run",
+	args: "-env NAME=attr:key=value,... [-env ...] -- <command> [arguments]",
+	help: "run a command with secrets injected into its environment",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		mapping := attrFlag{}
+		fs.Var(mapping, "env", "environment variable and secret reference as NAME=attr:key=value,key=value or NAME=secret-service://... May be repeated")
+
+		return func(args []string) error {
+			if len(args) == 0 || len(mapping) == 0 {
+				return errUsage
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Stdin = os.Stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+
+			// signals received before the child has been started are
+			// forwarded once it runs
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sigs)
+
+			if err := keyring.StartExec(context.Background(), svc, mapping, cmd); err != nil {
+				return err
+			}
+
+			done := make(chan struct{})
+			defer close(done)
+
+			go func() {
+				for {
+					select {
+					case sig := <-sigs:
+						_ = cmd.Process.Signal(sig)
+					case <-done:
+						return
+					}
+				}
+			}()
+
+			return cmd.Wait()
+		}
+	},
+}
+
+var renderCmd = &command{
+	name: "render",
+	args: "[-o file] <template>",
+	help: "render a template with {{ secret \"key=value,...\" }} placeholders",
+	setup: func(fs *flag.FlagSet) func([]string) error {
+		output := fs.String("o", "-", "file to write the result to with mode 0600. Use - for stdout")
+
+		return func(args []string) error {
+			if len(args) != 1 {
+				return errUsage
+			}
+
+			text, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+
+			svc, client, err := connect()
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			var buf bytes.Buffer
+			if err := keyring.RenderTemplate(context.Background(), svc, filepath.Base(args[0]), string(text), nil, &buf); err != nil {
+				return err
+			}
+
+			if *output == "-" {
+				_, err := buf.WriteTo(os.Stdout)
+				return err
+			}
+
+			return writePrivateFile(*output, buf.Bytes())
+		}
+	},
+}
+
+// connect returns a SecretService client on the session bus and the Client
+// that must be closed by the caller. Its DBus interactions are recorded if
+// recordEnv is set
+func connect() (keyring.SecretService, *keyring.Client, error) {
+	var opts keyring.ConnectOptions
+
+	if os.Getenv(recordEnv) != "" {
+		if recorder == nil {
+			recorder = keyring.NewRecorder()
+		}
+		opts.Recorder = recorder
+	}
+
+	return keyring.ConnectSecretService(opts)
+}
+
+// findCollection returns the collection with the given label or
+// the default collection if label is empty
+func findCollection(svc keyring.SecretService, label string) (keyring.Collection, error) {
+	if label == "" {
+		return svc.GetDefaultCollection()
+	}
+
+	return svc.GetCollection(label)
+}
+
+// lockOrUnlock locks or unlocks the collection named in args
+func lockOrUnlock(args []string, lock bool) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+
+	svc, client, err := connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var label string
+	if len(args) == 1 {
+		label = args[0]
+	}
+
+	col, err := findCollection(svc, label)
+	if err != nil {
+		return err
+	}
+
+	paths := []dbus.ObjectPath{col.Path()}
+	if lock {
+		_, err = svc.Lock(paths)
+	} else {
+		_, err = svc.Unlock(paths)
+	}
+
+	return err
+}
+
+// loadItemInfos loads the properties of all items. If withSecret is set
+// the secrets of all unlocked items are included
+func loadItemInfos(svc keyring.SecretService, items []keyring.Item, withSecret bool) ([]*itemInfo, error) {
+	var secrets map[dbus.ObjectPath]*keyring.Secret
+
+	if withSecret {
+		var paths []dbus.ObjectPath
+		for _, i := range items {
+			locked, err := i.Locked()
+			if err != nil {
+				return nil, err
+			}
+
+			if !locked {
+				paths = append(paths, i.Path())
+			}
+		}
+
+		if len(paths) > 0 {
+			session, err := svc.OpenSession()
+			if err != nil {
+				return nil, err
+			}
+			defer session.Close()
+
+			if secrets, err = svc.GetSecrets(paths, session.Path()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	infos := make([]*itemInfo, len(items))
+	for idx, i := range items {
+		var err error
+		if infos[idx], err = newItemInfo(i, secrets[i.Path()]); err != nil {
+			return nil, err
+		}
+	}
+
+	return infos, nil
+}
+
+// writePrivateFile atomically writes data to path with mode 0600. The data
+// is written to a temporary file in the same directory which is then
+// renamed so path never contains partial content or wider permissions
+func writePrivateFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
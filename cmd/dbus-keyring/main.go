@@ -0,0 +1,258 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+// Command dbus-keyring manages collections and secrets of a keyring
+// implementing the SecretService DBus API.
+//
+// Usage:
+//
+//	dbus-keyring <command> [flags] [arguments]
+//
+// Exit codes:
+//
+//	0  success
+//	1  generic error
+//	2  invalid usage
+//	3  collection, item or alias not found
+//	4  collection or item is locked
+//	5  prompt dismissed by the user
+//
+// The run command exits with the exit code of the started command.
+//
+// If invoked as "secret-tool" (e.g. through a symlink) or as
+// "dbus-keyring secret-tool" the command accepts the same arguments as
+// secret-tool from libsecret and behaves like it.
+//
+// If DBUS_KEYRING_RECORD is set to a file name, the DBus messages exchanged
+// with the secret service are written to that file as a fixture for
+// keyring.NewReplayer. Secret values are redacted.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+// Exit codes
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitNotFound  = 3
+	exitLocked    = 4
+	exitDismissed = 5
+)
+
+// recordEnv names the environment variable holding the file the DBus
+// interactions are recorded to
+const recordEnv = "DBUS_KEYRING_RECORD"
+
+// recorder records the DBus interactions if recordEnv is set
+var recorder *keyring.Recorder
+
+// errUsage is returned by commands if they are invoked with
+// invalid arguments
+var errUsage = errors.New("invalid usage")
+
+// command is a sub-command of dbus-keyring
+type command struct {
+	name  string
+	args  string
+	help  string
+	setup func(fs *flag.FlagSet) func(args []string) error
+}
+
+var commands = []*command{
+	collectionsCmd,
+	itemsCmd,
+	getCmd,
+	setCmd,
+	deleteCmd,
+	searchCmd,
+	lockCmd,
+	unlockCmd,
+	aliasCmd,
+	runCmd,
+	renderCmd,
+}
+
+func main() {
+	var code int
+	if filepath.Base(os.Args[0]) == "secret-tool" {
+		code = runSecretTool(os.Args[1:])
+	} else {
+		code = run(os.Args[1:])
+	}
+
+	if err := saveRecording(); err != nil {
+		fmt.Fprintf(os.Stderr, "dbus-keyring: failed to save recording: %s\n", err)
+		if code == exitOK {
+			code = exitError
+		}
+	}
+
+	os.Exit(code)
+}
+
+// saveRecording writes the recorded DBus interactions, if any, to the file
+// named by recordEnv
+func saveRecording() error {
+	if recorder == nil {
+		return nil
+	}
+
+	if err := recorder.Err(); err != nil {
+		return err
+	}
+
+	return recorder.Fixture().Save(os.Getenv(recordEnv))
+}
+
+func run(args []string) int {
+	if len(args) > 0 && args[0] == "secret-tool" {
+		return runSecretTool(args[1:])
+	}
+
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage()
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == args[0] {
+			cmd = c
+			break
+		}
+	}
+
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		usage()
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: dbus-keyring %s %s\n\n%s\n\n", cmd.name, cmd.args, cmd.help)
+		fs.PrintDefaults()
+	}
+
+	fn := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	err := fn(fs.Args())
+	code := exitCode(err)
+
+	// errors are reported in the output format requested by the command
+	var format string
+	if f := fs.Lookup("output"); f != nil {
+		format = f.Value.String()
+	}
+
+	switch {
+	case isExitError(err):
+		// the child started by run already reported the error
+	case err == errUsage:
+		fs.Usage()
+	case err != nil && (format == outputJSON || format == outputYAML):
+		_ = encode(os.Stderr, format, &errorInfo{
+			Error: err.Error(),
+			Code:  code,
+		})
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "dbus-keyring %s: %s\n", cmd.name, err)
+	}
+
+	return code
+}
+
+// exitCode returns the exit code for err or the errors wrapped by it
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	for ; err != nil; err = unwrap(err) {
+		switch {
+		case err == errUsage:
+			return exitUsage
+		case err == keyring.ErrNoSuchItem,
+			err == keyring.ErrUnknownCollection,
+			err == keyring.ErrUnknownAlias:
+			return exitNotFound
+		case keyring.IsLocked(err):
+			return exitLocked
+		case err == keyring.ErrPromptDismissed:
+			return exitDismissed
+		case isExitError(err):
+			return err.(*exec.ExitError).ExitCode()
+		}
+	}
+
+	return exitError
+}
+
+// unwrap returns the error wrapped by err or nil if err does not wrap an
+// error
+func unwrap(err error) error {
+	if u, ok := err.(interface{ Unwrap() error }); ok {
+		return u.Unwrap()
+	}
+
+	return nil
+}
+
+// isExitError returns true if err reports the exit status of a child process
+func isExitError(err error) bool {
+	_, ok := err.(*exec.ExitError)
+	return ok
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: dbus-keyring <command> [flags] [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.help)
+	}
+	fmt.Fprintf(os.Stderr, "  %-12s %s\n", "secret-tool", "secret-tool compatible mode (see \"dbus-keyring secret-tool\")")
+	fmt.Fprintf(os.Stderr, "\nUse \"dbus-keyring <command> -h\" for more information about a command\n")
+}
+
+// attrFlag implements flag.Value and collects key=value pairs
+type attrFlag map[string]string
+
+func (a attrFlag) String() string {
+	var parts []string
+	for k, v := range a {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+func (a attrFlag) Set(s string) error {
+	idx := strings.Index(s, "=")
+	if idx <= 0 {
+		return fmt.Errorf("expected key=value but got %q", s)
+	}
+
+	a[s[:idx]] = s[idx+1:]
+	return nil
+}
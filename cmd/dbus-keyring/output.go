@@ -0,0 +1,392 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+// Output formats supported by the -output flag. The JSON and YAML
+// formats share the same schema:
+//
+//	collection: {path, label, locked, created, modified}
+//	item:       {path, collection, label, attributes, locked, created, modified, secret?}
+//	secret:     {value, encoding, content_type}
+//	alias:      {name, collection}
+//
+// Listing commands print an array of objects while get prints a single
+// object. Times are formatted as RFC 3339. The secret value is only
+// included if requested using -with-secret (or by get) and is encoded as
+// "utf-8" or, for binary data, "base64". Errors are reported on stderr as
+// {error, code} where code is the exit code.
+const (
+	outputRaw   = "raw"
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// collectionInfo is the output schema of a collection
+type collectionInfo struct {
+	Path     string    `json:"path"`
+	Label    string    `json:"label"`
+	Locked   bool      `json:"locked"`
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+}
+
+// itemInfo is the output schema of an item
+type itemInfo struct {
+	Path       string            `json:"path"`
+	Collection string            `json:"collection"`
+	Label      string            `json:"label"`
+	Attributes map[string]string `json:"attributes"`
+	Locked     bool              `json:"locked"`
+	Created    time.Time         `json:"created"`
+	Modified   time.Time         `json:"modified"`
+	Secret     *secretInfo       `json:"secret,omitempty"`
+}
+
+// secretInfo is the output schema of a secret
+type secretInfo struct {
+	Value       string `json:"value"`
+	Encoding    string `json:"encoding"`
+	ContentType string `json:"content_type"`
+}
+
+// aliasInfo is the output schema of an alias
+type aliasInfo struct {
+	Name       string `json:"name"`
+	Collection string `json:"collection"`
+}
+
+// errorInfo is the output schema of errors in structured output modes
+type errorInfo struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// outputFlag registers the -output flag on fs
+func outputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", outputTable, "output format: json, yaml or table")
+}
+
+// checkFormat validates format
+func checkFormat(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+
+	return errUsage
+}
+
+// newCollectionInfo loads all properties of c
+func newCollectionInfo(c keyring.Collection) (*collectionInfo, error) {
+	info := &collectionInfo{
+		Path: string(c.Path()),
+	}
+
+	var err error
+	if info.Label, err = c.GetLabel(); err != nil {
+		return nil, err
+	}
+
+	if info.Locked, err = c.Locked(); err != nil {
+		return nil, err
+	}
+
+	if info.Created, err = c.GetCreated(); err != nil {
+		return nil, err
+	}
+
+	if info.Modified, err = c.GetModified(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// newItemInfo loads all properties of i. If secret is not nil it is
+// included in the result
+func newItemInfo(i keyring.Item, secret *keyring.Secret) (*itemInfo, error) {
+	p := string(i.Path())
+	info := &itemInfo{
+		Path:       p,
+		Collection: p[:strings.LastIndex(p, "/")],
+	}
+
+	var err error
+	if info.Label, err = i.GetLabel(); err != nil {
+		return nil, err
+	}
+
+	if info.Attributes, err = i.GetAttributes(); err != nil {
+		return nil, err
+	}
+
+	if info.Locked, err = i.Locked(); err != nil {
+		return nil, err
+	}
+
+	if info.Created, err = i.GetCreated(); err != nil {
+		return nil, err
+	}
+
+	if info.Modified, err = i.GetModified(); err != nil {
+		return nil, err
+	}
+
+	if secret != nil {
+		info.Secret = newSecretInfo(secret)
+	}
+
+	return info, nil
+}
+
+// newSecretInfo converts secret into its output schema
+func newSecretInfo(secret *keyring.Secret) *secretInfo {
+	info := &secretInfo{
+		ContentType: secret.ContentType,
+	}
+
+	if utf8.Valid(secret.Value.Bytes()) {
+		info.Value = secret.Value.Reveal()
+		info.Encoding = "utf-8"
+	} else {
+		info.Value = base64.StdEncoding.EncodeToString(secret.Value.Bytes())
+		info.Encoding = "base64"
+	}
+
+	return info
+}
+
+// printCollections writes collections to w in the given format
+func printCollections(w io.Writer, format string, collections []*collectionInfo) error {
+	if format != outputTable {
+		return encode(w, format, collections)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tLABEL\tLOCKED\tMODIFIED")
+	for _, c := range collections {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n", c.Path, c.Label, c.Locked, c.Modified.Format(time.RFC3339))
+	}
+
+	return tw.Flush()
+}
+
+// printItems writes items to w in the given format
+func printItems(w io.Writer, format string, items []*itemInfo) error {
+	if format != outputTable {
+		return encode(w, format, items)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tLABEL\tLOCKED\tATTRIBUTES")
+	for _, i := range items {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n", i.Path, i.Label, i.Locked, attrFlag(i.Attributes))
+	}
+
+	return tw.Flush()
+}
+
+// printAliases writes aliases to w in the given format
+func printAliases(w io.Writer, format string, aliases []*aliasInfo) error {
+	if format != outputTable {
+		return encode(w, format, aliases)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ALIAS\tCOLLECTION")
+	for _, a := range aliases {
+		fmt.Fprintf(tw, "%s\t%s\n", a.Name, a.Collection)
+	}
+
+	return tw.Flush()
+}
+
+// encode writes v to w as JSON or YAML
+func encode(w io.Writer, format string, v interface{}) error {
+	if format == outputYAML {
+		var sb strings.Builder
+		writeYAML(&sb, reflect.ValueOf(v), 0, false)
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYAML writes v as a YAML block. It supports the types used by the
+// output schema: structs with json tags, string maps, slices, strings,
+// bools, integers and time.Time. If inline is set the first line of a
+// mapping is written without indentation as it follows a "- " sequence marker
+func writeYAML(sb *strings.Builder, v reflect.Value, indent int, inline bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			sb.WriteString("null\n")
+			return
+		}
+		v = v.Elem()
+	}
+
+	pad := strings.Repeat("  ", indent)
+
+	if t, ok := v.Interface().(time.Time); ok {
+		sb.WriteString(yamlString(t.Format(time.RFC3339)) + "\n")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		first := true
+		for idx := 0; idx < v.NumField(); idx++ {
+			field := v.Type().Field(idx)
+			name, omitEmpty := jsonName(field)
+			if name == "" {
+				continue
+			}
+
+			fv := v.Field(idx)
+			if omitEmpty && isEmpty(fv) {
+				continue
+			}
+
+			if !(first && inline) {
+				sb.WriteString(pad)
+			}
+			first = false
+
+			sb.WriteString(name + ":")
+			writeYAMLValue(sb, fv, indent)
+		}
+
+	case reflect.Map:
+		if v.Len() == 0 {
+			sb.WriteString("{}\n")
+			return
+		}
+
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+
+		for idx, k := range keys {
+			if !(idx == 0 && inline) {
+				sb.WriteString(pad)
+			}
+
+			sb.WriteString(yamlString(k) + ":")
+			writeYAMLValue(sb, v.MapIndex(reflect.ValueOf(k)), indent)
+		}
+
+	case reflect.Slice:
+		if v.Len() == 0 {
+			sb.WriteString("[]\n")
+			return
+		}
+
+		for idx := 0; idx < v.Len(); idx++ {
+			if !(idx == 0 && inline) {
+				sb.WriteString(pad)
+			}
+			sb.WriteString("- ")
+			writeYAML(sb, v.Index(idx), indent+1, true)
+		}
+
+	case reflect.String:
+		sb.WriteString(yamlString(v.String()) + "\n")
+
+	default:
+		sb.WriteString(fmt.Sprintf("%v\n", v.Interface()))
+	}
+}
+
+// writeYAMLValue writes the value of a mapping entry
+func writeYAMLValue(sb *strings.Builder, v reflect.Value, indent int) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			sb.WriteString(" null\n")
+			return
+		}
+		v = v.Elem()
+	}
+
+	_, isTime := v.Interface().(time.Time)
+
+	switch {
+	case !isTime && v.Kind() == reflect.Struct,
+		v.Kind() == reflect.Map && v.Len() > 0,
+		v.Kind() == reflect.Slice && v.Len() > 0:
+		sb.WriteString("\n")
+		writeYAML(sb, v, indent+1, false)
+
+	case v.Kind() == reflect.Map:
+		sb.WriteString(" {}\n")
+
+	case v.Kind() == reflect.Slice:
+		sb.WriteString(" []\n")
+
+	default:
+		sb.WriteString(" ")
+		writeYAML(sb, v, indent, false)
+	}
+}
+
+// yamlString quotes s. JSON strings are valid YAML double-quoted scalars
+func yamlString(s string) string {
+	blob, _ := json.Marshal(s)
+	return string(blob)
+}
+
+// jsonName returns the name and omitempty option of the json tag of field
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			return name, true
+		}
+	}
+
+	return name, false
+}
+
+// isEmpty reports whether v is the zero value for the purpose of omitempty
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil() || (v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface && v.Len() == 0)
+	case reflect.String:
+		return v.Len() == 0
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEncodeYAML(t *testing.T) {
+	created := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{
+			name:  "struct",
+			value: &errorInfo{Error: "boom", Code: 3},
+			expected: "error: \"boom\"\n" +
+				"code: 3\n",
+		},
+		{
+			name:  "quoting",
+			value: []*aliasInfo{{Name: "a: b", Collection: "x\ny"}, {Name: "#c"}},
+			expected: "- name: \"a: b\"\n" +
+				"  collection: \"x\\ny\"\n" +
+				"- name: \"#c\"\n" +
+				"  collection: \"\"\n",
+		},
+		{
+			name: "nested maps",
+			value: &itemInfo{
+				Path:       "/p",
+				Attributes: map[string]string{"b": "2", "a": "yes"},
+				Created:    created,
+				Modified:   created,
+				Secret:     &secretInfo{Value: "s", Encoding: "utf-8"},
+			},
+			expected: "path: \"/p\"\n" +
+				"collection: \"\"\n" +
+				"label: \"\"\n" +
+				"attributes:\n" +
+				"  \"a\": \"yes\"\n" +
+				"  \"b\": \"2\"\n" +
+				"locked: false\n" +
+				"created: \"2019-01-02T03:04:05Z\"\n" +
+				"modified: \"2019-01-02T03:04:05Z\"\n" +
+				"secret:\n" +
+				"  value: \"s\"\n" +
+				"  encoding: \"utf-8\"\n" +
+				"  content_type: \"\"\n",
+		},
+		{
+			name: "nested maps in sequence",
+			value: []*itemInfo{{
+				Path:       "/p",
+				Attributes: map[string]string{"k": "v"},
+				Created:    created,
+				Modified:   created,
+			}},
+			expected: "- path: \"/p\"\n" +
+				"  collection: \"\"\n" +
+				"  label: \"\"\n" +
+				"  attributes:\n" +
+				"    \"k\": \"v\"\n" +
+				"  locked: false\n" +
+				"  created: \"2019-01-02T03:04:05Z\"\n" +
+				"  modified: \"2019-01-02T03:04:05Z\"\n",
+		},
+		{
+			name:  "empty values",
+			value: &itemInfo{Created: created, Modified: created},
+			expected: "path: \"\"\n" +
+				"collection: \"\"\n" +
+				"label: \"\"\n" +
+				"attributes: {}\n" +
+				"locked: false\n" +
+				"created: \"2019-01-02T03:04:05Z\"\n" +
+				"modified: \"2019-01-02T03:04:05Z\"\n",
+		},
+		{
+			name:     "empty sequence",
+			value:    []*itemInfo{},
+			expected: "[]\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encode(&buf, outputYAML, c.value); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if buf.String() != c.expected {
+				t.Errorf("expected\n%s\nbut got\n%s", c.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+// secret-tool compatibility mode. If dbus-keyring is invoked as "secret-tool"
+// (e.g. through a symlink) or using "dbus-keyring secret-tool" it accepts the
+// same arguments as the secret-tool command shipped with libsecret:
+//
+//	secret-tool store --label='label' [--collection=collection] attribute value ...
+//	secret-tool lookup attribute value ...
+//	secret-tool clear attribute value ...
+//	secret-tool search [--all] [--unlock] attribute value ...
+//	secret-tool lock --collection=collection
+//
+// Flags may be given before, between or after the attributes. Like
+// secret-tool it exits with 1 if lookup does not find a secret and with 2
+// on invalid usage.
+
+const secretToolUsage = `usage: secret-tool store --label='label' attribute value ...
+       secret-tool lookup attribute value ...
+       secret-tool clear attribute value ...
+       secret-tool search [--all] [--unlock] attribute value ...
+       secret-tool lock --collection='collection'
+`
+
+// runSecretTool implements the secret-tool compatible command mode
+func runSecretTool(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, secretToolUsage)
+		return exitUsage
+	}
+
+	var err error
+	switch args[0] {
+	case "store":
+		err = secretToolStore(args[1:])
+	case "lookup":
+		err = secretToolLookup(args[1:])
+	case "clear":
+		err = secretToolClear(args[1:])
+	case "search":
+		err = secretToolSearch(args[1:])
+	case "lock":
+		err = secretToolLock(args[1:])
+	default:
+		err = errUsage
+	}
+
+	switch {
+	case err == errUsage:
+		fmt.Fprint(os.Stderr, secretToolUsage)
+		return exitUsage
+	case err == errNotFound:
+		return exitError
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "secret-tool: %s\n", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// errNotFound is returned by lookup if no secret matches. secret-tool exits
+// with 1 without printing an error in that case
+var errNotFound = errors.New("not found")
+
+// secretToolFlags returns a flag set for the secret-tool command name
+func secretToolFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("secret-tool "+name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+// parseSecretToolArgs parses the flags in args using fs and returns the
+// remaining arguments. Unlike fs.Parse it does not stop at the first
+// non-flag argument, only at "--"
+func parseSecretToolArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+
+		rest := fs.Args()
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+
+		if len(rest) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// parseAttributes parses "attribute value" pairs
+func parseAttributes(args []string) (map[string]string, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, errUsage
+	}
+
+	attrs := make(map[string]string, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		attrs[args[i]] = args[i+1]
+	}
+
+	return attrs, nil
+}
+
+// collectionPath converts the --collection argument of secret-tool into
+// an object path. Anything but an object path is treated as an alias
+func collectionPath(collection string) dbus.ObjectPath {
+	if collection == "" {
+		return keyring.DefaultCollection
+	}
+
+	if strings.HasPrefix(collection, "/") {
+		return dbus.ObjectPath(collection)
+	}
+
+	return dbus.ObjectPath(keyring.AliasesPath + "/" + collection)
+}
+
+func secretToolStore(args []string) error {
+	fs := secretToolFlags("store")
+	label := fs.String("label", "", "")
+	fs.StringVar(label, "l", "", "")
+	collection := fs.String("collection", "", "")
+	fs.StringVar(collection, "c", "", "")
+	rest, err := parseSecretToolArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *label == "" {
+		return errUsage
+	}
+
+	attrs, err := parseAttributes(rest)
+	if err != nil {
+		return err
+	}
+
+	secret, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	svc, client, err := connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	col, err := svc.GetCollectionByPath(collectionPath(*collection))
+	if err != nil {
+		return err
+	}
+
+	locked, err := col.Locked()
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		if _, err := svc.Unlock([]dbus.ObjectPath{col.Path()}); err != nil {
+			return err
+		}
+	}
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	_, err = col.CreateItem(session.Path(), *label, attrs, secret, "text/plain", true)
+	return err
+}
+
+func secretToolLookup(args []string) error {
+	rest, err := parseSecretToolArgs(secretToolFlags("lookup"), args)
+	if err != nil {
+		return err
+	}
+
+	attrs, err := parseAttributes(rest)
+	if err != nil {
+		return err
+	}
+
+	results, err := secretToolFind(attrs, true)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		if res.Secret == nil {
+			continue
+		}
+
+		os.Stdout.Write(res.Secret.Value.Bytes())
+		if isTerminal(os.Stdout) {
+			fmt.Println()
+		}
+		return nil
+	}
+
+	return errNotFound
+}
+
+func secretToolClear(args []string) error {
+	rest, err := parseSecretToolArgs(secretToolFlags("clear"), args)
+	if err != nil {
+		return err
+	}
+
+	attrs, err := parseAttributes(rest)
+	if err != nil {
+		return err
+	}
+
+	svc, client, err := connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	unlocked, locked, err := svc.SearchItems(attrs)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range append(unlocked, locked...) {
+		if err := i.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func secretToolSearch(args []string) error {
+	fs := secretToolFlags("search")
+	all := fs.Bool("all", false, "")
+	fs.BoolVar(all, "a", false, "")
+	unlock := fs.Bool("unlock", false, "")
+	fs.BoolVar(unlock, "u", false, "")
+	rest, err := parseSecretToolArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	attrs, err := parseAttributes(rest)
+	if err != nil {
+		return err
+	}
+
+	results, err := secretToolFind(attrs, *unlock)
+	if err != nil {
+		return err
+	}
+
+	if !*all && len(results) > 1 {
+		results = results[:1]
+	}
+
+	for _, res := range results {
+		if err := printSecretToolItem(res); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func secretToolLock(args []string) error {
+	fs := secretToolFlags("lock")
+	collection := fs.String("collection", "", "")
+	fs.StringVar(collection, "c", "", "")
+	rest, err := parseSecretToolArgs(fs, args)
+	if err != nil || len(rest) != 0 || *collection == "" {
+		return errUsage
+	}
+
+	svc, client, err := connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	col, err := svc.GetCollectionByPath(collectionPath(*collection))
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.Lock([]dbus.ObjectPath{col.Path()})
+	return err
+}
+
+// secretToolFind searches for items matching attrs including their secrets.
+// Unlocked items are returned first
+func secretToolFind(attrs map[string]string, unlock bool) ([]*keyring.SearchResult, error) {
+	svc, client, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	results, err := svc.SearchAndRetrieve(context.Background(), attrs, keyring.RetrieveOptions{
+		Unlock: unlock,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sorted []*keyring.SearchResult
+	for _, res := range results {
+		if !res.Locked {
+			sorted = append(sorted, res)
+		}
+	}
+	for _, res := range results {
+		if res.Locked {
+			sorted = append(sorted, res)
+		}
+	}
+
+	return sorted, nil
+}
+
+// printSecretToolItem prints res in the format used by secret-tool search
+func printSecretToolItem(res *keyring.SearchResult) error {
+	const timeFormat = "2006-01-02 15:04:05"
+
+	w := bufio.NewWriter(os.Stdout)
+
+	fmt.Fprintf(w, "[%s]\n", res.Path)
+	fmt.Fprintf(w, "label = %s\n", res.Label)
+
+	if res.Secret != nil {
+		fmt.Fprint(w, "secret = ")
+		w.Write(res.Secret.Value.Bytes())
+		fmt.Fprintln(w)
+	}
+
+	created, err := res.Item.GetCreated()
+	if err != nil {
+		return err
+	}
+
+	modified, err := res.Item.GetModified()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "created = %s\n", created.Format(timeFormat))
+	fmt.Fprintf(w, "modified = %s\n", modified.Format(timeFormat))
+
+	if schema, ok := res.Attributes[keyring.XDGSchemaAttribute]; ok {
+		fmt.Fprintf(w, "schema = %s\n", schema)
+	}
+
+	keys := make([]string, 0, len(res.Attributes))
+	for k := range res.Attributes {
+		if k != keyring.XDGSchemaAttribute {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "attribute.%s = %s\n", k, res.Attributes[k])
+	}
+
+	return w.Flush()
+}
+
+// readPassword reads the secret from stdin. If stdin is a terminal the
+// user is prompted and the trailing newline is removed
+func readPassword() ([]byte, error) {
+	if !isTerminal(os.Stdin) {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	defer fmt.Fprintln(os.Stderr)
+
+	restore, err := disableEcho(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	line, err := bufio.NewReader(os.Stdin).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, err
+	}
+
+	return []byte(strings.TrimRight(string(line), "\r\n")), nil
+}
+
+// isTerminal returns true if f is a character device
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
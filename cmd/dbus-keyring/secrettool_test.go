@@ -0,0 +1,137 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSecretToolArgs(t *testing.T) {
+	cases := []struct {
+		name       string
+		args       []string
+		label      string
+		collection string
+		rest       []string
+		err        error
+	}{
+		{
+			name:  "flags first",
+			args:  []string{"--label=db", "service", "db"},
+			label: "db",
+			rest:  []string{"service", "db"},
+		},
+		{
+			name:  "flags last",
+			args:  []string{"service", "db", "--label", "db"},
+			label: "db",
+			rest:  []string{"service", "db"},
+		},
+		{
+			name:       "interspersed short flags",
+			args:       []string{"service", "-l", "db", "user", "-c", "login", "app"},
+			label:      "db",
+			collection: "login",
+			rest:       []string{"service", "user", "app"},
+		},
+		{
+			name:  "terminator",
+			args:  []string{"-l", "db", "--", "-service", "--label"},
+			label: "db",
+			rest:  []string{"-service", "--label"},
+		},
+		{
+			name: "no arguments",
+		},
+		{
+			name: "unknown flag",
+			args: []string{"service", "db", "--unknown"},
+			err:  errUsage,
+		},
+		{
+			name: "missing value",
+			args: []string{"service", "db", "--label"},
+			err:  errUsage,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fs := secretToolFlags("store")
+			label := fs.String("label", "", "")
+			fs.StringVar(label, "l", "", "")
+			collection := fs.String("collection", "", "")
+			fs.StringVar(collection, "c", "", "")
+
+			rest, err := parseSecretToolArgs(fs, c.args)
+			if err != c.err {
+				t.Fatalf("expected error %v but got %v", c.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if *label != c.label {
+				t.Errorf("expected label %q but got %q", c.label, *label)
+			}
+
+			if *collection != c.collection {
+				t.Errorf("expected collection %q but got %q", c.collection, *collection)
+			}
+
+			if !reflect.DeepEqual(rest, c.rest) {
+				t.Errorf("expected arguments %q but got %q", c.rest, rest)
+			}
+		})
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	cases := []struct {
+		name  string
+		args  []string
+		attrs map[string]string
+		err   error
+	}{
+		{
+			name:  "single",
+			args:  []string{"service", "db"},
+			attrs: map[string]string{"service": "db"},
+		},
+		{
+			name:  "multiple",
+			args:  []string{"service", "db", "user", "app"},
+			attrs: map[string]string{"service": "db", "user": "app"},
+		},
+		{
+			name:  "empty value",
+			args:  []string{"service", ""},
+			attrs: map[string]string{"service": ""},
+		},
+		{
+			name: "missing value",
+			args: []string{"service", "db", "user"},
+			err:  errUsage,
+		},
+		{
+			name: "empty",
+			err:  errUsage,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			attrs, err := parseAttributes(c.args)
+			if err != c.err {
+				t.Fatalf("expected error %v but got %v", c.err, err)
+			}
+
+			if !reflect.DeepEqual(attrs, c.attrs) {
+				t.Errorf("expected %v but got %v", c.attrs, attrs)
+			}
+		})
+	}
+}
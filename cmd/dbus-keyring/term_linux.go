@@ -0,0 +1,37 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// disableEcho disables echoing of input characters on the terminal f and
+// returns a function to restore the previous state
+func disableEcho(f *os.File) (func(), error) {
+	var state syscall.Termios
+	if err := ioctl(f.Fd(), syscall.TCGETS, &state); err != nil {
+		return nil, err
+	}
+
+	noEcho := state
+	noEcho.Lflag &^= syscall.ECHO
+	if err := ioctl(f.Fd(), syscall.TCSETS, &noEcho); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		_ = ioctl(f.Fd(), syscall.TCSETS, &state)
+	}, nil
+}
+
+func ioctl(fd uintptr, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import "os"
+
+// disableEcho is not supported on this platform and does nothing
+func disableEcho(f *os.File) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,240 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+// Command docker-credential-dbus-keyring is a docker credential helper that
+// stores registry credentials using the SecretService DBus API.
+//
+// Credentials are stored with the same attributes as docker-credential-secretservice
+// (schema io.docker.Credentials) so existing credentials are found. To use it
+// add the following to ~/.docker/config.json:
+//
+//	{ "credsStore": "dbus-keyring" }
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+const (
+	// dockerSchema is the schema name used by docker-credential-secretservice
+	dockerSchema = "io.docker.Credentials"
+
+	// credsLabel is the value of the label attribute used by docker
+	credsLabel = "Docker Credentials"
+)
+
+// errCredentialsNotFound uses the message expected by the docker CLI
+var errCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// credentials is the JSON payload of the store and get actions
+type credentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <store|get|erase|list|version>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "store":
+		err = store(os.Stdin)
+	case "get":
+		err = get(os.Stdin, os.Stdout)
+	case "erase":
+		err = erase(os.Stdin)
+	case "list":
+		err = list(os.Stdout)
+	case "version":
+		fmt.Println("docker-credential-dbus-keyring")
+	default:
+		err = fmt.Errorf("unknown action: %s", os.Args[1])
+	}
+
+	// the docker CLI reads error messages from stdout
+	if err != nil {
+		fmt.Fprintln(os.Stdout, err)
+		os.Exit(1)
+	}
+}
+
+// schemaAttributes returns the attributes used to find items for serverURL.
+// Like docker-credential-secretservice the docker_cli attribute is only used
+// when listing so credentials stored by older versions are found as well
+func schemaAttributes(serverURL string) map[string]string {
+	return map[string]string{
+		keyring.XDGSchemaAttribute: dockerSchema,
+		"server":                   serverURL,
+	}
+}
+
+// readServerURL reads the server URL sent by the docker CLI
+func readServerURL(r io.Reader) (string, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	serverURL := strings.TrimSpace(string(blob))
+	if serverURL == "" {
+		return "", errors.New("no credentials server URL")
+	}
+
+	return serverURL, nil
+}
+
+func store(r io.Reader) error {
+	var creds credentials
+	if err := json.NewDecoder(r).Decode(&creds); err != nil {
+		return err
+	}
+
+	if creds.ServerURL == "" {
+		return errors.New("no credentials server URL")
+	}
+
+	if creds.Username == "" {
+		return errors.New("no credentials username")
+	}
+
+	svc, client, err := keyring.ConnectSecretService(keyring.ConnectOptions{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	col, err := svc.GetDefaultCollection()
+	if err != nil {
+		return err
+	}
+
+	locked, err := col.Locked()
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		if _, err := svc.Unlock([]dbus.ObjectPath{col.Path()}); err != nil {
+			return err
+		}
+	}
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	attrs := schemaAttributes(creds.ServerURL)
+	attrs["label"] = credsLabel
+	attrs["username"] = creds.Username
+	attrs["docker_cli"] = "1"
+
+	_, err = col.CreateItem(session.Path(), creds.ServerURL, attrs, []byte(creds.Secret), "text/plain", true)
+	return err
+}
+
+func get(r io.Reader, w io.Writer) error {
+	serverURL, err := readServerURL(r)
+	if err != nil {
+		return err
+	}
+
+	svc, client, err := keyring.ConnectSecretService(keyring.ConnectOptions{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	results, err := svc.SearchAndRetrieve(context.Background(), schemaAttributes(serverURL), keyring.RetrieveOptions{
+		Unlock: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		if res.Secret == nil {
+			continue
+		}
+
+		return json.NewEncoder(w).Encode(&credentials{
+			ServerURL: serverURL,
+			Username:  res.Attributes["username"],
+			Secret:    res.Secret.Value.Reveal(),
+		})
+	}
+
+	return errCredentialsNotFound
+}
+
+func erase(r io.Reader) error {
+	serverURL, err := readServerURL(r)
+	if err != nil {
+		return err
+	}
+
+	svc, client, err := keyring.ConnectSecretService(keyring.ConnectOptions{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	unlocked, locked, err := svc.SearchItems(schemaAttributes(serverURL))
+	if err != nil {
+		return err
+	}
+
+	// erasing missing credentials succeeds like in
+	// docker-credential-secretservice as docker logout relies on it
+	for _, i := range append(unlocked, locked...) {
+		if err := i.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func list(w io.Writer) error {
+	svc, client, err := keyring.ConnectSecretService(keyring.ConnectOptions{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	attrs := map[string]string{
+		keyring.XDGSchemaAttribute: dockerSchema,
+		"docker_cli":               "1",
+	}
+
+	results, err := svc.SearchAndRetrieve(context.Background(), attrs, keyring.RetrieveOptions{
+		SkipSecrets: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	accounts := make(map[string]string, len(results))
+	for _, res := range results {
+		if server, ok := res.Attributes["server"]; ok {
+			accounts[server] = res.Attributes["username"]
+		}
+	}
+
+	return json.NewEncoder(w).Encode(accounts)
+}
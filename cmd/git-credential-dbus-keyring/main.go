@@ -0,0 +1,249 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+// Command git-credential-dbus-keyring is a git credential helper that stores
+// credentials using the SecretService DBus API.
+//
+// Credentials are stored with the same attributes as git-credential-libsecret
+// (schema org.git.Password) so existing credentials keep working. To use it
+// configure git with:
+//
+//	git config --global credential.helper dbus-keyring
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+const (
+	// gitSchema is the schema name used by git-credential-libsecret
+	gitSchema = "org.git.Password"
+)
+
+// credential holds the fields of git's credential helper protocol
+type credential struct {
+	protocol string
+	host     string
+	port     uint16
+	path     string
+	username string
+	password string
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <get|store|erase>\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	c, err := readCredential(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "get":
+		err = get(c, os.Stdout)
+	case "store":
+		err = store(c)
+	case "erase":
+		err = erase(c)
+	default:
+		// git ignores unknown actions
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+		os.Exit(1)
+	}
+}
+
+// readCredential parses key=value lines until EOF or an empty line
+func readCredential(r io.Reader) (*credential, error) {
+	c := &credential{}
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid credential line: %q", line)
+		}
+
+		key, value := line[:idx], line[idx+1:]
+		switch key {
+		case "protocol":
+			c.protocol = value
+		case "host":
+			c.host = value
+			if i := strings.LastIndex(value, ":"); i >= 0 {
+				if port, err := strconv.ParseUint(value[i+1:], 10, 16); err == nil {
+					c.host = value[:i]
+					c.port = uint16(port)
+				}
+			}
+		case "path":
+			c.path = value
+		case "username":
+			c.username = value
+		case "password":
+			c.password = value
+		}
+	}
+
+	return c, scanner.Err()
+}
+
+// attributes returns the search attributes for c as used by git-credential-libsecret
+func (c *credential) attributes() map[string]string {
+	attrs := make(map[string]string)
+
+	if c.username != "" {
+		attrs["user"] = c.username
+	}
+	if c.protocol != "" {
+		attrs["protocol"] = c.protocol
+	}
+	if c.host != "" {
+		attrs["server"] = c.host
+	}
+	if c.port != 0 {
+		attrs["port"] = strconv.FormatUint(uint64(c.port), 10)
+	}
+	if c.path != "" {
+		attrs["object"] = c.path
+	}
+
+	return attrs
+}
+
+// label returns the item label as used by git-credential-libsecret. The
+// host is always followed by a "/" even if the path is empty
+func (c *credential) label() string {
+	label := "Git: " + c.protocol + "://" + c.host
+	if c.port != 0 {
+		label += ":" + strconv.FormatUint(uint64(c.port), 10)
+	}
+
+	return label + "/" + c.path
+}
+
+// empty returns true if c does not contain any field used for matching
+func (c *credential) empty() bool {
+	return c.protocol == "" && c.host == "" && c.path == "" && c.username == ""
+}
+
+func get(c *credential, w io.Writer) error {
+	if c.empty() {
+		return nil
+	}
+
+	svc, client, err := keyring.ConnectSecretService(keyring.ConnectOptions{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	results, err := svc.SearchAndRetrieve(context.Background(), c.attributes(), keyring.RetrieveOptions{
+		Unlock: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, res := range results {
+		if res.Secret == nil {
+			continue
+		}
+
+		if user, ok := res.Attributes["user"]; ok && c.username == "" {
+			fmt.Fprintf(w, "username=%s\n", user)
+		}
+		fmt.Fprintf(w, "password=%s\n", res.Secret.Value.Reveal())
+
+		return nil
+	}
+
+	return nil
+}
+
+func store(c *credential) error {
+	// git-credential-libsecret silently ignores incomplete credentials
+	if c.empty() || c.password == "" {
+		return nil
+	}
+
+	svc, client, err := keyring.ConnectSecretService(keyring.ConnectOptions{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	col, err := svc.GetDefaultCollection()
+	if err != nil {
+		return err
+	}
+
+	locked, err := col.Locked()
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		if _, err := svc.Unlock([]dbus.ObjectPath{col.Path()}); err != nil {
+			return err
+		}
+	}
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	attrs := c.attributes()
+	attrs[keyring.XDGSchemaAttribute] = gitSchema
+
+	_, err = col.CreateItem(session.Path(), c.label(), attrs, []byte(c.password), "text/plain", true)
+	return err
+}
+
+func erase(c *credential) error {
+	if c.empty() {
+		return nil
+	}
+
+	svc, client, err := keyring.ConnectSecretService(keyring.ConnectOptions{})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	unlocked, locked, err := svc.SearchItems(c.attributes())
+	if err != nil {
+		return err
+	}
+
+	for _, i := range append(unlocked, locked...) {
+		if err := i.Delete(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
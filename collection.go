@@ -5,6 +5,7 @@ package keyring
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 )
@@ -44,6 +45,12 @@ type Collection interface {
 	// Locked returns true if the collection is locked
 	Locked() (bool, error)
 
+	// GetCreated returns the time the collection has been created
+	GetCreated() (time.Time, error)
+
+	// GetModified returns the time the collection has been last modified
+	GetModified() (time.Time, error)
+
 	// Delete deletes the collection and handles any prompt required
 	Delete() error
 
@@ -56,19 +63,47 @@ type Collection interface {
 	// SearchItems searches for items in the collection
 	SearchItems(attrs map[string]string) ([]Item, error)
 
+	// Query searches for items in the collection that match q. The exact
+	// attribute matches of q are passed to SearchItems
+	Query(q *Query) ([]Item, error)
+
 	// CreateItem creates a new item inside the collection optionally overwritting an
 	// existing one
-	CreateItem(session dbus.ObjectPath, label string, attr map[string]string, secret []byte, contentType string, replace bool) (Item, error)
+	CreateItem(session dbus.ObjectPath, label string, attr map[string]string, secret SecretValue, contentType string, replace bool) (Item, error)
+
+	// Upsert creates or updates the single item that matches attrs. Unlike CreateItem
+	// it does not depend on the replace semantics of the secret service provider.
+	// If more than one item matches attrs an *AmbiguousMatchError is returned
+	Upsert(session dbus.ObjectPath, attrs map[string]string, label string, secret SecretValue, contentType string) (Item, error)
+}
+
+// AmbiguousMatchError is returned by Collection.Upsert if more than one
+// item matches the provided attributes
+type AmbiguousMatchError struct {
+	// Attributes holds the attributes used for the search
+	Attributes map[string]string
+
+	// Matches is the number of items found
+	Matches int
+}
+
+func (e *AmbiguousMatchError) Error() string {
+	return fmt.Sprintf("ambiguous match: %d items match the attributes %v", e.Matches, e.Attributes)
 }
 
 type collection struct {
-	conn *dbus.Conn
+	conn busConn
 	path dbus.ObjectPath
 	obj  dbus.BusObject
 }
 
 // GetCollection returns a collection object for the specified path
 func GetCollection(conn *dbus.Conn, path dbus.ObjectPath) (Collection, error) {
+	return newCollection(conn, path)
+}
+
+// newCollection returns a collection object for the specified path on conn
+func newCollection(conn busConn, path dbus.ObjectPath) (Collection, error) {
 	obj := conn.Object(SecretServiceDest, dbus.ObjectPath(path))
 	coll := &collection{
 		conn: conn,
@@ -105,7 +140,7 @@ func (c *collection) GetLabel() (string, error) {
 
 // SetLabel sets the label of the connection
 func (c *collection) SetLabel(l string) error {
-	return c.obj.SetProperty(collectionPropLabel, l)
+	return c.obj.SetProperty(collectionPropLabel, dbus.MakeVariant(l))
 }
 
 // Locked returns true if the collection is locked
@@ -122,6 +157,36 @@ func (c *collection) Locked() (bool, error) {
 	return false, ErrInvalidType("bool", v.Value())
 }
 
+// GetCreated returns the time the collection has been created
+func (c *collection) GetCreated() (time.Time, error) {
+	v, err := c.obj.GetProperty(collectionPropCreated)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	u, ok := v.Value().(uint64)
+	if !ok {
+		return time.Time{}, ErrInvalidType("uint64", v.Value())
+	}
+
+	return time.Unix(int64(u), 0), nil
+}
+
+// GetModified returns the time the collection has been last modified
+func (c *collection) GetModified() (time.Time, error) {
+	v, err := c.obj.GetProperty(collectionPropModified)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	u, ok := v.Value().(uint64)
+	if !ok {
+		return time.Time{}, ErrInvalidType("uint64", v.Value())
+	}
+
+	return time.Unix(int64(u), 0), nil
+}
+
 // Delete deletes the collection and handles any prompt required
 func (c *collection) Delete() error {
 	call := c.obj.Call(collectionMethodDelete, 0)
@@ -135,7 +200,7 @@ func (c *collection) Delete() error {
 	}
 
 	if promptPath != "/" {
-		p := GetPrompt(c.conn, promptPath)
+		p := newPrompt(c.conn, promptPath)
 		res, err := p.Prompt("")
 		if err != nil {
 			return err
@@ -143,7 +208,7 @@ func (c *collection) Delete() error {
 
 		result := <-res
 		if result == nil {
-			return fmt.Errorf("prompted dismissed")
+			return ErrPromptDismissed
 		}
 	}
 
@@ -160,7 +225,7 @@ func (c *collection) GetAllItems() ([]Item, error) {
 	if list, ok := v.Value().([]dbus.ObjectPath); ok {
 		items := make([]Item, len(list))
 		for i, it := range list {
-			items[i], err = GetItem(c.conn, it)
+			items[i], err = newItem(c.conn, it)
 			if err != nil {
 				return nil, err
 			}
@@ -190,7 +255,7 @@ func (c *collection) GetItem(name string) (Item, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("no such item")
+	return nil, ErrNoSuchItem
 }
 
 // SearchItems searches for items in the collection
@@ -211,7 +276,7 @@ func (c *collection) SearchItems(attrs map[string]string) ([]Item, error) {
 
 	items := make([]Item, len(list))
 	for i, it := range list {
-		items[i], err = GetItem(c.conn, it)
+		items[i], err = newItem(c.conn, it)
 		if err != nil {
 			return nil, err
 		}
@@ -220,9 +285,27 @@ func (c *collection) SearchItems(attrs map[string]string) ([]Item, error) {
 	return items, nil
 }
 
+// Query searches for items in the collection that match q. The exact
+// attribute matches of q are passed to SearchItems
+func (c *collection) Query(q *Query) ([]Item, error) {
+	var items []Item
+	var err error
+
+	if len(q.Attributes) > 0 {
+		items, err = c.SearchItems(q.Attributes)
+	} else {
+		items, err = c.GetAllItems()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Filter(items)
+}
+
 // CreateItem creates a new item inside the collection optionally overwritting an
 // existing one
-func (c *collection) CreateItem(session dbus.ObjectPath, label string, attr map[string]string, secret []byte, contentType string, replace bool) (Item, error) {
+func (c *collection) CreateItem(session dbus.ObjectPath, label string, attr map[string]string, secret SecretValue, contentType string, replace bool) (Item, error) {
 	sec := Secret{
 		Session:     session,
 		Parameters:  []byte(""),
@@ -248,5 +331,67 @@ func (c *collection) CreateItem(session dbus.ObjectPath, label string, attr map[
 		return nil, ErrInvalidType("ObjectPath", call.Body[0])
 	}
 
-	return GetItem(c.conn, itemPath)
+	promptPath, ok := call.Body[1].(dbus.ObjectPath)
+	if !ok {
+		return nil, ErrInvalidType("ObjectPath", call.Body[1])
+	}
+
+	// some providers require a prompt and return the item path as the
+	// prompt result
+	if promptPath != "/" {
+		p := newPrompt(c.conn, promptPath)
+		res, err := p.Prompt("")
+		if err != nil {
+			return nil, err
+		}
+
+		result := <-res
+		if result == nil {
+			return nil, ErrPromptDismissed
+		}
+
+		itemPath, ok = result.Value().(dbus.ObjectPath)
+		if !ok {
+			return nil, ErrInvalidType("ObjectPath", result.Value())
+		}
+	}
+
+	return newItem(c.conn, itemPath)
+}
+
+// Upsert creates or updates the single item that matches attrs. Unlike CreateItem
+// it does not depend on the replace semantics of the secret service provider.
+// If more than one item matches attrs an *AmbiguousMatchError is returned
+func (c *collection) Upsert(session dbus.ObjectPath, attrs map[string]string, label string, secret SecretValue, contentType string) (Item, error) {
+	items, err := c.SearchItems(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(items) {
+	case 0:
+		return c.CreateItem(session, label, attrs, secret, contentType, false)
+	case 1:
+	default:
+		return nil, &AmbiguousMatchError{
+			Attributes: attrs,
+			Matches:    len(items),
+		}
+	}
+
+	item := items[0]
+
+	if err := item.SetLabel(label); err != nil {
+		return nil, err
+	}
+
+	if err := item.SetAttributes(attrs); err != nil {
+		return nil, err
+	}
+
+	if err := item.SetSecret(session, secret, contentType); err != nil {
+		return nil, err
+	}
+
+	return item, nil
 }
@@ -4,6 +4,7 @@
 package keyring
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/godbus/dbus/v5"
@@ -19,9 +20,22 @@ const (
 	ItemInterface       = SecretServicePrefix + "Item"
 	ServiceInterface    = SecretServicePrefix + "Service"
 	PromptInterface     = SecretServicePrefix + "Prompt"
-	DefaultCollection   = SecretServicePath + "/aliases/default"
+	AliasesPath         = SecretServicePath + "/aliases"
+	DefaultCollection   = AliasesPath + "/default"
 	SessionCollection   = SecretServicePath + "/collection/session"
 
+	// DefaultAlias is the alias of the default collection
+	DefaultAlias = "default"
+	// DefaultCollectionLabel is the label used when creating the default collection
+	DefaultCollectionLabel = "Login"
+	// XDGSchemaAttribute is the attribute used by libsecret to store the schema name
+	XDGSchemaAttribute = "xdg:schema"
+
+	// Errors defined by the Secret Service API
+	ErrorIsLocked     = SecretServicePrefix + "Error.IsLocked"
+	ErrorNoSession    = SecretServicePrefix + "Error.NoSession"
+	ErrorNoSuchObject = SecretServicePrefix + "Error.NoSuchObject"
+
 	AlgPlain = "plain"
 	// AlgDH is not yet supported only AlgPlain is supported
 	AlgDH = "dh-ietf1024-sha256-aes128-cbc-pkcs7"
@@ -32,10 +46,45 @@ const (
 type Secret struct {
 	Session     dbus.ObjectPath
 	Parameters  []byte
-	Value       []byte
+	Value       SecretValue
 	ContentType string
+
+	// buf holds the secure memory backing Value, if any. Unexported
+	// fields are ignored by dbus
+	buf *secureBuffer
 }
 
+var (
+	// ErrPromptDismissed is returned if the user dismissed a prompt
+	ErrPromptDismissed = errors.New("prompt dismissed")
+
+	// ErrUnknownAlias is returned if an alias does not reference a collection
+	ErrUnknownAlias = errors.New("unknown alias")
+
+	// ErrUnknownCollection is returned if no collection with the given label exists
+	ErrUnknownCollection = errors.New("unknown collection")
+
+	// ErrNoSuchItem is returned if no item with the given label exists
+	ErrNoSuchItem = errors.New("no such item")
+)
+
 func ErrInvalidType(expected string, value interface{}) error {
 	return fmt.Errorf("invalid type: expected a '%s' but got '%T'", expected, value)
 }
+
+// IsLocked returns true if err is the IsLocked error of the Secret Service API
+func IsLocked(err error) bool {
+	return isDBusError(err, ErrorIsLocked)
+}
+
+// isDBusError returns true if err is a D-Bus error with the given name
+func isDBusError(err error, name string) bool {
+	switch e := err.(type) {
+	case dbus.Error:
+		return e.Name == name
+	case *dbus.Error:
+		return e != nil && e.Name == name
+	}
+
+	return false
+}
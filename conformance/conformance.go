@@ -0,0 +1,1117 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+// Package conformance checks that a secret service provider implements the
+// Secret Service API as specified. It exercises sessions, collections, items,
+// aliases, locking, prompts and signals through package keyring using a
+// throwaway collection that is deleted afterwards.
+//
+// The checks can be run against any keyring.SecretService: a real provider
+// connected using keyring.Connect or the in-memory implementation of package
+// keyringfake. Providers that ask the user to confirm prompts, like
+// gnome-keyring, require the user to accept them while the checks run.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+const (
+	// DefaultLabel is the label prefix of the throwaway collection
+	DefaultLabel = "go-dbus-keyring conformance"
+
+	// DefaultSignalTimeout is the default time to wait for a signal
+	DefaultSignalTimeout = 2 * time.Second
+
+	// contentType is the content type of the secrets stored by the checks
+	contentType = "text/plain"
+)
+
+// Options configures Run
+type Options struct {
+	// Label is the label of the throwaway collection. Defaults to
+	// DefaultLabel followed by a unique suffix
+	Label string
+
+	// Conn, if set, is used to receive the signals of the secret service
+	// and to dismiss prompts. Signal and prompt checks are skipped otherwise
+	Conn *dbus.Conn
+
+	// SignalTimeout is the time to wait for a signal. Defaults to
+	// DefaultSignalTimeout
+	SignalTimeout time.Duration
+}
+
+// Run runs all checks against svc and returns the report. Checks that depend
+// on a failed check are skipped. Run stops early, skipping all remaining
+// checks, if ctx is cancelled
+func Run(ctx context.Context, svc keyring.SecretService, opts Options) *Report {
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	if opts.Label == "" {
+		opts.Label = DefaultLabel + " " + id
+	}
+
+	if opts.SignalTimeout <= 0 {
+		opts.SignalTimeout = DefaultSignalTimeout
+	}
+
+	s := &suite{
+		ctx:  ctx,
+		svc:  svc,
+		opts: opts,
+		id:   id,
+		attrs: map[string]string{
+			"conformance": id,
+		},
+		report: &Report{
+			Provider: keyring.ProviderUnknown,
+			Started:  time.Now(),
+		},
+	}
+
+	if opts.Conn != nil {
+		s.signals = newSignalLog(opts.Conn)
+		defer s.signals.close()
+	}
+
+	defer s.cleanup()
+
+	for _, c := range checks {
+		s.run(c.name, c.fn)
+	}
+
+	return s.report
+}
+
+// check is a named check
+type check struct {
+	name string
+	fn   func(s *suite) error
+}
+
+// checks lists all checks in the order they are run
+var checks = []check{
+	{"session/open", (*suite).openSession},
+	{"service/capabilities", (*suite).capabilities},
+	{"collection/create", (*suite).createCollection},
+	{"signal/CollectionCreated", (*suite).collectionCreatedSignal},
+	{"collection/properties", (*suite).collectionProperties},
+	{"signal/CollectionChanged", (*suite).collectionChangedSignal},
+	{"service/collections", (*suite).serviceCollections},
+	{"alias/set-read-remove", (*suite).aliases},
+	{"alias/list", (*suite).listAliases},
+	{"item/create", (*suite).createItem},
+	{"signal/ItemCreated", (*suite).itemCreatedSignal},
+	{"item/properties", (*suite).itemProperties},
+	{"signal/ItemChanged", (*suite).itemChangedSignal},
+	{"item/secret", (*suite).itemSecret},
+	{"item/replace", (*suite).replaceItem},
+	{"collection/upsert", (*suite).upsert},
+	{"collection/search", (*suite).collectionSearch},
+	{"service/search", (*suite).serviceSearch},
+	{"service/get-secrets", (*suite).getSecrets},
+	{"lock/collection", (*suite).lockCollection},
+	{"prompt/dismiss", (*suite).dismissPrompt},
+	{"unlock/collection", (*suite).unlockCollection},
+	{"unlock/item", (*suite).unlockItem},
+	{"item/delete", (*suite).deleteItem},
+	{"signal/ItemDeleted", (*suite).itemDeletedSignal},
+	{"session/close", (*suite).closeSession},
+	{"collection/delete", (*suite).deleteCollection},
+	{"signal/CollectionDeleted", (*suite).collectionDeletedSignal},
+}
+
+// skipError marks a check as skipped
+type skipError string
+
+func (e skipError) Error() string {
+	return string(e)
+}
+
+// skip returns an error that marks the check as skipped
+func skip(format string, args ...interface{}) error {
+	return skipError(fmt.Sprintf(format, args...))
+}
+
+// suite holds the state shared by the checks
+type suite struct {
+	ctx     context.Context
+	svc     keyring.SecretService
+	opts    Options
+	id      string
+	attrs   map[string]string
+	report  *Report
+	signals *signalLog
+
+	caps     *keyring.Capabilities
+	session  keyring.Session
+	col      keyring.Collection
+	item     keyring.Item
+	itemPath dbus.ObjectPath
+	colPath  dbus.ObjectPath
+	deleted  bool
+}
+
+// run runs fn as the check name and adds its result to the report
+func (s *suite) run(name string, fn func(s *suite) error) {
+	res := Result{
+		Name: name,
+	}
+
+	start := time.Now()
+
+	var err error
+	if err = s.ctx.Err(); err != nil {
+		err = skip("%s", err)
+	} else {
+		err = fn(s)
+	}
+
+	res.Duration = time.Since(start)
+
+	switch e := err.(type) {
+	case nil:
+		res.Status = Pass
+	case skipError:
+		res.Status = Skip
+		res.Message = string(e)
+	default:
+		res.Status = Fail
+		res.Message = err.Error()
+	}
+
+	s.report.Results = append(s.report.Results, res)
+}
+
+// cleanup deletes the throwaway collection if a check failed before
+// deleting it
+func (s *suite) cleanup() {
+	if s.col != nil && !s.deleted {
+		_ = s.col.Delete()
+	}
+
+	if s.session != nil {
+		_ = s.session.Close()
+	}
+}
+
+// requireSession skips the check if no session has been opened
+func (s *suite) requireSession() error {
+	if s.session == nil {
+		return skip("requires session/open")
+	}
+
+	return nil
+}
+
+// requireCollection skips the check if the collection has not been created
+func (s *suite) requireCollection() error {
+	if s.col == nil || s.deleted {
+		return skip("requires collection/create")
+	}
+
+	return nil
+}
+
+// requireItem skips the check if the item has not been created
+func (s *suite) requireItem() error {
+	if err := s.requireCollection(); err != nil {
+		return err
+	}
+
+	if s.item == nil {
+		return skip("requires item/create")
+	}
+
+	return s.requireSession()
+}
+
+// requireSignals skips the check if signals cannot be received
+func (s *suite) requireSignals(path dbus.ObjectPath) error {
+	if s.signals == nil {
+		return skip("no connection to receive signals")
+	}
+
+	if path == "" {
+		return skip("no object the signal is emitted for")
+	}
+
+	return nil
+}
+
+// itemAttrs returns the attributes of the item with key set to value
+func (s *suite) itemAttrs(key, value string) map[string]string {
+	attrs := map[string]string{}
+	for k, v := range s.attrs {
+		attrs[k] = v
+	}
+	attrs[key] = value
+
+	return attrs
+}
+
+// expectPath returns an error if got is not want
+func expectPath(what string, got, want dbus.ObjectPath) error {
+	if got != want {
+		return fmt.Errorf("%s: got %s, want %s", what, got, want)
+	}
+
+	return nil
+}
+
+// containsPath returns true if items contains an item with the given path
+func containsPath(items []keyring.Item, path dbus.ObjectPath) bool {
+	for _, i := range items {
+		if i.Path() == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *suite) openSession() error {
+	session, err := s.svc.OpenSession()
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(string(session.Path()), keyring.SecretServicePath+"/session/") {
+		_ = session.Close()
+		return fmt.Errorf("unexpected session path %s", session.Path())
+	}
+
+	s.session = session
+	return nil
+}
+
+func (s *suite) capabilities() error {
+	caps, err := s.svc.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	s.caps = caps
+	s.report.Provider = caps.Provider
+
+	if !caps.SupportsAlgorithm(keyring.AlgPlain) {
+		return fmt.Errorf("algorithm %q is not supported", keyring.AlgPlain)
+	}
+
+	return nil
+}
+
+func (s *suite) createCollection() error {
+	col, err := s.svc.CreateCollection(s.opts.Label, "")
+	if err != nil {
+		return err
+	}
+
+	s.col = col
+	s.colPath = col.Path()
+
+	if !strings.HasPrefix(string(s.colPath), keyring.SecretServicePath+"/collection/") {
+		return fmt.Errorf("unexpected collection path %s", s.colPath)
+	}
+
+	return nil
+}
+
+func (s *suite) collectionCreatedSignal() error {
+	if err := s.requireSignals(s.colPath); err != nil {
+		return err
+	}
+
+	return s.signals.wait(keyring.ServiceInterface+".CollectionCreated", s.colPath, s.opts.SignalTimeout)
+}
+
+func (s *suite) collectionProperties() error {
+	if err := s.requireCollection(); err != nil {
+		return err
+	}
+
+	label, err := s.col.GetLabel()
+	if err != nil {
+		return err
+	}
+	if label != s.opts.Label {
+		return fmt.Errorf("Label: got %q, want %q", label, s.opts.Label)
+	}
+
+	renamed := s.opts.Label + " (renamed)"
+	if err := s.col.SetLabel(renamed); err != nil {
+		return err
+	}
+	if label, err = s.col.GetLabel(); err != nil {
+		return err
+	}
+	if label != renamed {
+		return fmt.Errorf("Label after SetLabel: got %q, want %q", label, renamed)
+	}
+	if err := s.col.SetLabel(s.opts.Label); err != nil {
+		return err
+	}
+
+	locked, err := s.col.Locked()
+	if err != nil {
+		return err
+	}
+	if locked {
+		return errors.New("new collection is locked")
+	}
+
+	created, err := s.col.GetCreated()
+	if err != nil {
+		return err
+	}
+	if created.IsZero() {
+		return errors.New("Created is not set")
+	}
+
+	modified, err := s.col.GetModified()
+	if err != nil {
+		return err
+	}
+	if modified.Before(created) {
+		return fmt.Errorf("Modified %s is before Created %s", modified, created)
+	}
+
+	return nil
+}
+
+func (s *suite) collectionChangedSignal() error {
+	if err := s.requireSignals(s.colPath); err != nil {
+		return err
+	}
+
+	return s.signals.wait(keyring.ServiceInterface+".CollectionChanged", s.colPath, s.opts.SignalTimeout)
+}
+
+func (s *suite) serviceCollections() error {
+	if err := s.requireCollection(); err != nil {
+		return err
+	}
+
+	all, err := s.svc.GetAllCollections()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, c := range all {
+		if c.Path() == s.colPath {
+			found = true
+		}
+	}
+	if !found {
+		return errors.New("Collections does not list the new collection")
+	}
+
+	col, err := s.svc.GetCollectionByPath(s.colPath)
+	if err != nil {
+		return err
+	}
+	if err := expectPath("GetCollectionByPath", col.Path(), s.colPath); err != nil {
+		return err
+	}
+
+	col, err = s.svc.GetCollection(s.opts.Label)
+	if err != nil {
+		return err
+	}
+
+	return expectPath("GetCollection", col.Path(), s.colPath)
+}
+
+func (s *suite) aliases() error {
+	if err := s.requireCollection(); err != nil {
+		return err
+	}
+
+	if s.caps != nil && !s.caps.Aliases {
+		return skip("provider does not support aliases")
+	}
+
+	alias := "conformance" + s.id
+
+	if err := s.svc.SetAlias(alias, s.colPath); err != nil {
+		return err
+	}
+
+	path, err := s.svc.ReadAlias(alias)
+	if err != nil {
+		_ = s.svc.RemoveAlias(alias)
+		return err
+	}
+	if err := expectPath("ReadAlias", path, s.colPath); err != nil {
+		_ = s.svc.RemoveAlias(alias)
+		return err
+	}
+
+	col, err := s.svc.GetCollectionByAlias(alias)
+	if err != nil {
+		_ = s.svc.RemoveAlias(alias)
+		return err
+	}
+	if err := expectPath("GetCollectionByAlias", col.Path(), s.colPath); err != nil {
+		_ = s.svc.RemoveAlias(alias)
+		return err
+	}
+
+	if err := s.svc.RemoveAlias(alias); err != nil {
+		return err
+	}
+
+	if path, err := s.svc.ReadAlias(alias); err != keyring.ErrUnknownAlias {
+		return fmt.Errorf("ReadAlias after RemoveAlias: got %s, %v", path, err)
+	}
+
+	return nil
+}
+
+func (s *suite) listAliases() error {
+	if s.caps != nil && !s.caps.Aliases {
+		return skip("provider does not support aliases")
+	}
+
+	aliases, err := s.svc.ListAliases()
+	if err != nil {
+		return skip("aliases cannot be listed: %s", err)
+	}
+
+	path, err := s.svc.ReadAlias(keyring.DefaultAlias)
+	if err == keyring.ErrUnknownAlias {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return expectPath("default alias", aliases[keyring.DefaultAlias], path)
+}
+
+func (s *suite) createItem() error {
+	if err := s.requireCollection(); err != nil {
+		return err
+	}
+	if err := s.requireSession(); err != nil {
+		return err
+	}
+
+	item, err := s.col.CreateItem(s.session.Path(), "item "+s.id, s.attrs, keyring.SecretValue("secret"), contentType, false)
+	if err != nil {
+		return err
+	}
+
+	s.item = item
+	s.itemPath = item.Path()
+
+	if !strings.HasPrefix(string(s.itemPath), string(s.colPath)+"/") {
+		return fmt.Errorf("item path %s is not below the collection %s", s.itemPath, s.colPath)
+	}
+
+	return nil
+}
+
+func (s *suite) itemCreatedSignal() error {
+	if err := s.requireSignals(s.itemPath); err != nil {
+		return err
+	}
+
+	return s.signals.wait(keyring.CollectionInterface+".ItemCreated", s.itemPath, s.opts.SignalTimeout)
+}
+
+func (s *suite) itemProperties() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	label := "item " + s.id + " (renamed)"
+	if err := s.item.SetLabel(label); err != nil {
+		return err
+	}
+
+	got, err := s.item.GetLabel()
+	if err != nil {
+		return err
+	}
+	if got != label {
+		return fmt.Errorf("Label: got %q, want %q", got, label)
+	}
+
+	attrs := s.itemAttrs("extra", "value")
+	if err := s.item.SetAttributes(attrs); err != nil {
+		return err
+	}
+
+	gotAttrs, err := s.item.GetAttributes()
+	if err != nil {
+		return err
+	}
+	for k, v := range attrs {
+		if gotAttrs[k] != v {
+			return fmt.Errorf("Attributes: got %v, want %v", gotAttrs, attrs)
+		}
+	}
+
+	if err := s.item.SetAttributes(s.attrs); err != nil {
+		return err
+	}
+
+	locked, err := s.item.Locked()
+	if err != nil {
+		return err
+	}
+	if locked {
+		return errors.New("new item is locked")
+	}
+
+	created, err := s.item.GetCreated()
+	if err != nil {
+		return err
+	}
+	if created.IsZero() {
+		return errors.New("Created is not set")
+	}
+
+	modified, err := s.item.GetModified()
+	if err != nil {
+		return err
+	}
+	if modified.Before(created) {
+		return fmt.Errorf("Modified %s is before Created %s", modified, created)
+	}
+
+	return nil
+}
+
+func (s *suite) itemChangedSignal() error {
+	if err := s.requireSignals(s.itemPath); err != nil {
+		return err
+	}
+
+	return s.signals.wait(keyring.CollectionInterface+".ItemChanged", s.itemPath, s.opts.SignalTimeout)
+}
+
+// expectSecret returns an error if the secret of item is not value
+func (s *suite) expectSecret(item keyring.Item, value string) error {
+	secret, err := item.GetSecret(s.session.Path())
+	if err != nil {
+		return err
+	}
+
+	if string(secret.Value) != value {
+		return errors.New("GetSecret returned a different value")
+	}
+
+	if secret.ContentType != "" && secret.ContentType != contentType {
+		return fmt.Errorf("ContentType: got %q, want %q", secret.ContentType, contentType)
+	}
+
+	return nil
+}
+
+func (s *suite) itemSecret() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	if err := s.expectSecret(s.item, "secret"); err != nil {
+		return err
+	}
+
+	if err := s.item.SetSecret(s.session.Path(), keyring.SecretValue("changed"), contentType); err != nil {
+		return err
+	}
+
+	return s.expectSecret(s.item, "changed")
+}
+
+func (s *suite) replaceItem() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	item, err := s.col.CreateItem(s.session.Path(), "item "+s.id, s.attrs, keyring.SecretValue("replaced"), contentType, true)
+	if err != nil {
+		return err
+	}
+
+	if item.Path() != s.itemPath {
+		_ = item.Delete()
+		return fmt.Errorf("CreateItem with replace created %s instead of replacing %s", item.Path(), s.itemPath)
+	}
+
+	return s.expectSecret(s.item, "replaced")
+}
+
+func (s *suite) upsert() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	item, err := s.col.Upsert(s.session.Path(), s.attrs, "item "+s.id, keyring.SecretValue("upserted"), contentType)
+	if err != nil {
+		return err
+	}
+
+	if err := expectPath("Upsert", item.Path(), s.itemPath); err != nil {
+		_ = item.Delete()
+		return err
+	}
+
+	return s.expectSecret(s.item, "upserted")
+}
+
+func (s *suite) collectionSearch() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	all, err := s.col.GetAllItems()
+	if err != nil {
+		return err
+	}
+	if len(all) != 1 || all[0].Path() != s.itemPath {
+		return fmt.Errorf("Items: got %d items, want only %s", len(all), s.itemPath)
+	}
+
+	item, err := s.col.GetItem("item " + s.id)
+	if err != nil {
+		return err
+	}
+	if err := expectPath("GetItem", item.Path(), s.itemPath); err != nil {
+		return err
+	}
+
+	found, err := s.col.SearchItems(s.attrs)
+	if err != nil {
+		return err
+	}
+	if len(found) != 1 || found[0].Path() != s.itemPath {
+		return fmt.Errorf("SearchItems: got %d items, want only %s", len(found), s.itemPath)
+	}
+
+	found, err = s.col.SearchItems(s.itemAttrs("conformance", "no-match"))
+	if err != nil {
+		return err
+	}
+	if len(found) != 0 {
+		return fmt.Errorf("SearchItems with non-matching attributes returned %d items", len(found))
+	}
+
+	found, err = s.col.Query(&keyring.Query{Attributes: s.attrs})
+	if err != nil {
+		return err
+	}
+	if !containsPath(found, s.itemPath) {
+		return errors.New("Query did not return the item")
+	}
+
+	return nil
+}
+
+func (s *suite) serviceSearch() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	unlocked, locked, err := s.svc.SearchItems(s.attrs)
+	if err != nil {
+		return err
+	}
+	if !containsPath(unlocked, s.itemPath) {
+		return errors.New("SearchItems did not return the item as unlocked")
+	}
+	if containsPath(locked, s.itemPath) {
+		return errors.New("SearchItems returned the item as locked")
+	}
+
+	item, err := s.svc.GetItemByPath(s.itemPath)
+	if err != nil {
+		return err
+	}
+
+	return expectPath("GetItemByPath", item.Path(), s.itemPath)
+}
+
+func (s *suite) getSecrets() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	secrets, err := s.svc.GetSecrets([]dbus.ObjectPath{s.itemPath}, s.session.Path())
+	if err != nil {
+		return err
+	}
+
+	secret, ok := secrets[s.itemPath]
+	if !ok {
+		return errors.New("GetSecrets did not return the secret of the item")
+	}
+	if string(secret.Value) != "upserted" {
+		return errors.New("GetSecrets returned a different value")
+	}
+
+	results, err := s.svc.SearchAndRetrieve(s.ctx, s.attrs, keyring.RetrieveOptions{
+		Session: s.session,
+	})
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 || results[0].Path != s.itemPath || results[0].Secret == nil {
+		return errors.New("SearchAndRetrieve did not return the secret of the item")
+	}
+
+	return nil
+}
+
+func (s *suite) lockCollection() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	if _, err := s.svc.Lock([]dbus.ObjectPath{s.colPath}); err != nil {
+		return err
+	}
+
+	locked, err := s.col.Locked()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("collection is not locked after Lock")
+	}
+
+	if locked, err = s.item.Locked(); err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("item of a locked collection is not locked")
+	}
+
+	_, lockedItems, err := s.svc.SearchItems(s.attrs)
+	if err != nil {
+		return err
+	}
+	if !containsPath(lockedItems, s.itemPath) {
+		return errors.New("SearchItems did not return the item as locked")
+	}
+
+	if _, err := s.item.GetSecret(s.session.Path()); !keyring.IsLocked(err) {
+		return fmt.Errorf("GetSecret of a locked item: got %v, want %s", err, keyring.ErrorIsLocked)
+	}
+
+	return nil
+}
+
+// dismissPrompt requests the prompt to unlock the locked collection and
+// dismisses it instead of performing it
+func (s *suite) dismissPrompt() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+	if err := s.requireSignals(s.colPath); err != nil {
+		return err
+	}
+
+	var unlocked []dbus.ObjectPath
+	var path dbus.ObjectPath
+
+	obj := s.opts.Conn.Object(keyring.SecretServiceDest, keyring.SecretServicePath)
+	err := obj.CallWithContext(s.ctx, keyring.ServiceInterface+".Unlock", 0, []dbus.ObjectPath{s.colPath}).Store(&unlocked, &path)
+	if err != nil {
+		return err
+	}
+
+	if path == "/" {
+		return skip("provider unlocked the collection without a prompt")
+	}
+
+	if err := keyring.GetPrompt(s.opts.Conn, path).Dismiss(); err != nil {
+		return err
+	}
+
+	sig, err := s.signals.waitEmitted(keyring.PromptInterface+".Completed", path, s.opts.SignalTimeout)
+	if err != nil {
+		return err
+	}
+
+	var dismissed bool
+	var result dbus.Variant
+	if err := dbus.Store(sig.Body, &dismissed, &result); err != nil {
+		return fmt.Errorf("Completed: %s", err)
+	}
+	if !dismissed {
+		return errors.New("Completed does not report the prompt as dismissed")
+	}
+
+	locked, err := s.col.Locked()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errors.New("collection is unlocked after dismissing the prompt")
+	}
+
+	return nil
+}
+
+func (s *suite) unlockCollection() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	unlocked, err := s.svc.Unlock([]dbus.ObjectPath{s.colPath})
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, p := range unlocked {
+		if p == s.colPath {
+			found = true
+		}
+	}
+	if !found {
+		return errors.New("Unlock did not report the collection as unlocked")
+	}
+
+	locked, err := s.col.Locked()
+	if err != nil {
+		return err
+	}
+	if locked {
+		return errors.New("collection is locked after Unlock")
+	}
+
+	return s.expectSecret(s.item, "upserted")
+}
+
+func (s *suite) unlockItem() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	if _, err := s.svc.Lock([]dbus.ObjectPath{s.colPath}); err != nil {
+		return err
+	}
+
+	ok, err := s.item.Unlock()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("Item.Unlock did not unlock the item")
+	}
+
+	locked, err := s.item.Locked()
+	if err != nil {
+		return err
+	}
+	if locked {
+		return errors.New("item is locked after Unlock")
+	}
+
+	return nil
+}
+
+func (s *suite) deleteItem() error {
+	if err := s.requireItem(); err != nil {
+		return err
+	}
+
+	if err := s.item.Delete(); err != nil {
+		return err
+	}
+	s.item = nil
+
+	unlocked, locked, err := s.svc.SearchItems(s.attrs)
+	if err != nil {
+		return err
+	}
+	if containsPath(unlocked, s.itemPath) || containsPath(locked, s.itemPath) {
+		return errors.New("SearchItems returned the deleted item")
+	}
+
+	return nil
+}
+
+func (s *suite) itemDeletedSignal() error {
+	if err := s.requireSignals(s.itemPath); err != nil {
+		return err
+	}
+
+	return s.signals.wait(keyring.CollectionInterface+".ItemDeleted", s.itemPath, s.opts.SignalTimeout)
+}
+
+func (s *suite) closeSession() error {
+	if err := s.requireSession(); err != nil {
+		return err
+	}
+
+	path := s.session.Path()
+	if err := s.session.Close(); err != nil {
+		return err
+	}
+	s.session = nil
+
+	if s.col == nil || s.deleted {
+		return nil
+	}
+
+	// a closed session must not be usable to transfer secrets
+	item, err := s.col.CreateItem(path, "closed session "+s.id, s.itemAttrs("session", "closed"), keyring.SecretValue("secret"), contentType, false)
+	if err == nil {
+		_ = item.Delete()
+		return errors.New("CreateItem succeeded with a closed session")
+	}
+
+	return nil
+}
+
+func (s *suite) deleteCollection() error {
+	if err := s.requireCollection(); err != nil {
+		return err
+	}
+
+	if err := s.col.Delete(); err != nil {
+		return err
+	}
+	s.deleted = true
+
+	all, err := s.svc.GetAllCollections()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range all {
+		if c.Path() == s.colPath {
+			return errors.New("Collections lists the deleted collection")
+		}
+	}
+
+	return nil
+}
+
+func (s *suite) collectionDeletedSignal() error {
+	if err := s.requireSignals(s.colPath); err != nil {
+		return err
+	}
+
+	return s.signals.wait(keyring.ServiceInterface+".CollectionDeleted", s.colPath, s.opts.SignalTimeout)
+}
+
+// signalLog collects the signals of the secret service
+type signalLog struct {
+	conn    *dbus.Conn
+	ch      chan *dbus.Signal
+	done    chan struct{}
+	matches [][]dbus.MatchOption
+
+	l       sync.Mutex
+	signals []*dbus.Signal
+	changed chan struct{}
+}
+
+// newSignalLog starts collecting the signals of the secret service on conn
+func newSignalLog(conn *dbus.Conn) *signalLog {
+	sl := &signalLog{
+		conn:    conn,
+		ch:      make(chan *dbus.Signal, 16),
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+		matches: [][]dbus.MatchOption{
+			{dbus.WithMatchInterface(keyring.ServiceInterface)},
+			{dbus.WithMatchInterface(keyring.CollectionInterface)},
+			{dbus.WithMatchInterface(keyring.PromptInterface)},
+		},
+	}
+
+	for _, m := range sl.matches {
+		_ = conn.AddMatchSignal(m...)
+	}
+
+	conn.Signal(sl.ch)
+
+	go func() {
+		for {
+			select {
+			case <-sl.done:
+				return
+			case s, ok := <-sl.ch:
+				if !ok {
+					return
+				}
+
+				sl.l.Lock()
+				sl.signals = append(sl.signals, s)
+				close(sl.changed)
+				sl.changed = make(chan struct{})
+				sl.l.Unlock()
+			}
+		}
+	}()
+
+	return sl
+}
+
+// close stops collecting signals
+func (sl *signalLog) close() {
+	sl.conn.RemoveSignal(sl.ch)
+	close(sl.done)
+
+	for _, m := range sl.matches {
+		_ = sl.conn.RemoveMatchSignal(m...)
+	}
+}
+
+// wait waits for the signal name with path as its first argument
+func (sl *signalLog) wait(name string, path dbus.ObjectPath, timeout time.Duration) error {
+	_, err := sl.find(name, path, timeout, func(s *dbus.Signal) bool {
+		return len(s.Body) > 0 && s.Body[0] == path
+	})
+
+	return err
+}
+
+// waitEmitted waits for the signal name emitted by the object at path
+func (sl *signalLog) waitEmitted(name string, path dbus.ObjectPath, timeout time.Duration) (*dbus.Signal, error) {
+	return sl.find(name, path, timeout, func(s *dbus.Signal) bool {
+		return s.Path == path
+	})
+}
+
+// find waits for the signal name for which match returns true
+func (sl *signalLog) find(name string, path dbus.ObjectPath, timeout time.Duration, match func(*dbus.Signal) bool) (*dbus.Signal, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		sl.l.Lock()
+		for _, s := range sl.signals {
+			if s.Name == name && match(s) {
+				sl.l.Unlock()
+				return s, nil
+			}
+		}
+		changed := sl.changed
+		sl.l.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, fmt.Errorf("%s for %s not received within %s", name, path, timeout)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package conformance_test
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/conformance"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+// checkReport fails t if a check failed or, unless skipped lists it, has
+// been skipped
+func checkReport(t *testing.T, report *conformance.Report, skipped ...string) {
+	t.Helper()
+
+	allowed := make(map[string]bool)
+	for _, name := range skipped {
+		allowed[name] = true
+	}
+
+	for _, res := range report.Results {
+		switch {
+		case res.Status == conformance.Fail:
+			t.Errorf("%s failed: %s", res.Name, res.Message)
+		case res.Status == conformance.Skip && !allowed[res.Name]:
+			t.Errorf("%s skipped: %s", res.Name, res.Message)
+		}
+	}
+
+	if !report.Passed() {
+		t.Errorf("report did not pass")
+	}
+}
+
+func TestRunFake(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	report := conformance.Run(ctx, keyringfake.New(), conformance.Options{})
+
+	var signals []string
+	for _, res := range report.Results {
+		if strings.HasPrefix(res.Name, "signal/") || strings.HasPrefix(res.Name, "prompt/") {
+			signals = append(signals, res.Name)
+		}
+	}
+
+	checkReport(t, report, signals...)
+}
+
+func TestRunFakeOnBus(t *testing.T) {
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	bus, err := keyringfake.StartBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	if err := bus.Serve(keyringfake.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := keyring.Connect(keyring.ConnectOptions{
+		Address: bus.Address,
+		Private: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	svc, err := client.SecretService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	report := conformance.Run(ctx, svc, conformance.Options{
+		Conn: client.Conn(),
+	})
+
+	checkReport(t, report)
+}
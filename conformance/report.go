@@ -0,0 +1,93 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package conformance
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+// Status is the outcome of a check
+type Status int
+
+// Possible outcomes of a check
+const (
+	// Pass means the provider behaved as specified
+	Pass Status = iota
+
+	// Fail means the provider did not behave as specified
+	Fail
+
+	// Skip means the check has not been run because a check it depends on
+	// failed or the provider does not support the feature
+	Skip
+)
+
+// String returns the name of s
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Fail:
+		return "FAIL"
+	case Skip:
+		return "SKIP"
+	}
+
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Result is the result of a single check
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report holds the results of all checks run against a provider
+type Report struct {
+	Provider keyring.Provider `json:"provider"`
+	Started  time.Time        `json:"started"`
+	Results  []Result         `json:"results"`
+}
+
+// Count returns the number of checks with the given status
+func (r *Report) Count(s Status) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == s {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Passed returns true if no check failed
+func (r *Report) Passed() bool {
+	return r.Count(Fail) == 0
+}
+
+// WriteText writes a human readable report to w
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	for _, res := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.Status, res.Name, res.Duration.Round(time.Millisecond), res.Message)
+	}
+
+	fmt.Fprintf(tw, "\nprovider: %s\tpassed: %d\tfailed: %d\tskipped: %d\n", r.Provider, r.Count(Pass), r.Count(Fail), r.Count(Skip))
+
+	return tw.Flush()
+}
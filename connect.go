@@ -0,0 +1,759 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// DefaultReconnectInterval is the delay between reconnection attempts
+	DefaultReconnectInterval = time.Second
+
+	// DefaultReconnectTimeout is the time calls wait for a lost connection
+	// to be re-established
+	DefaultReconnectTimeout = 5 * time.Second
+
+	propertiesGet = "org.freedesktop.DBus.Properties.Get"
+	propertiesSet = "org.freedesktop.DBus.Properties.Set"
+)
+
+// busConn is the subset of *dbus.Conn used by the clients of this package.
+// It is implemented by *dbus.Conn and *Client
+type busConn interface {
+	Object(dest string, path dbus.ObjectPath) dbus.BusObject
+	Signal(ch chan<- *dbus.Signal)
+	RemoveSignal(ch chan<- *dbus.Signal)
+	AddMatchSignal(options ...dbus.MatchOption) error
+	RemoveMatchSignal(options ...dbus.MatchOption) error
+}
+
+// sessionTracker is implemented by connections that re-open sessions after
+// the connection has been re-established
+type sessionTracker interface {
+	trackSession(s *session)
+	untrackSession(s *session)
+}
+
+// ConnectOptions configures the connection established by Connect
+type ConnectOptions struct {
+	// Address is the DBus address to connect to. If empty, the session bus
+	// from DBUS_SESSION_BUS_ADDRESS is used
+	Address string
+
+	// Private opens a private connection instead of sharing the session bus
+	// connection of the process (see dbus.SessionBus)
+	Private bool
+
+	// PeerToPeer connects directly to a secret service listening on Address
+	// instead of a message bus. Implies Private
+	PeerToPeer bool
+
+	// Reconnect re-establishes the connection if it is lost. Sessions opened
+	// through the client are re-opened and signal subscriptions are registered
+	// again. Replacement connections are always private
+	Reconnect bool
+
+	// ReconnectInterval is the delay between reconnection attempts. Defaults
+	// to DefaultReconnectInterval
+	ReconnectInterval time.Duration
+
+	// ReconnectTimeout is the time calls wait for a lost connection to be
+	// re-established. Defaults to DefaultReconnectTimeout
+	ReconnectTimeout time.Duration
+
+	// WatchProvider detects restarts of the secret service provider. Sessions
+	// are re-opened and calls on handles to objects that vanished with the
+	// restart return a *StaleHandleError (see WatchSecretService)
+	WatchProvider bool
+
+	// Audit, if set, records all reads and writes of secrets performed by
+	// the clients returned by SecretService (see AuditSecretService)
+	Audit *AuditOptions
+
+	// Observer, if set, is notified about each call, property access, prompt
+	// and signal of the clients returned by SecretService
+	Observer Observer
+
+	// Activation, if set, configures the clients returned by SecretService
+	// to activate the secret service and retry calls while it is not
+	// available (see ActivateSecretService)
+	Activation *ActivationOptions
+
+	// Recorder, if set, records the DBus interactions of the clients
+	// returned by SecretService (see RecordSecretService)
+	Recorder *Recorder
+}
+
+// Client is a connection to the secret service established by Connect
+type Client struct {
+	opts    ConnectOptions
+	done    chan struct{}
+	cancel  context.CancelFunc
+	watcher *providerWatcher
+
+	l        sync.Mutex
+	conn     *dbus.Conn
+	shared   bool
+	detach   func()
+	ready    chan struct{}
+	closed   bool
+	signals  map[chan<- *dbus.Signal]*signalTarget
+	matches  map[string]*matchRule
+	sessions map[*session]struct{}
+	closers  []func()
+}
+
+// signalTarget is a channel registered using Client.Signal. Signals are
+// queued and delivered in order by a single goroutine so that a slow
+// receiver does not block other targets
+type signalTarget struct {
+	ch   chan<- *dbus.Signal
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	l     sync.Mutex
+	queue []*dbus.Signal
+}
+
+// newSignalTarget returns a signalTarget delivering to ch
+func newSignalTarget(ch chan<- *dbus.Signal) *signalTarget {
+	t := &signalTarget{
+		ch:   ch,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	t.wg.Add(1)
+	go t.run()
+
+	return t
+}
+
+// push queues signals for delivery
+func (t *signalTarget) push(signals ...*dbus.Signal) {
+	t.l.Lock()
+	t.queue = append(t.queue, signals...)
+	t.l.Unlock()
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued signals until stop is called
+func (t *signalTarget) run() {
+	defer t.wg.Done()
+
+	for {
+		t.l.Lock()
+		queue := t.queue
+		t.queue = nil
+		t.l.Unlock()
+
+		for _, s := range queue {
+			select {
+			case t.ch <- s:
+			case <-t.done:
+				return
+			}
+		}
+
+		select {
+		case <-t.wake:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// stop stops delivering signals and waits for run to return
+func (t *signalTarget) stop() {
+	close(t.done)
+	t.wg.Wait()
+}
+
+// matchRule is a match rule registered using Client.AddMatchSignal
+type matchRule struct {
+	options []dbus.MatchOption
+	refs    int
+}
+
+// Connect connects to the secret service as configured by opts
+func Connect(opts ConnectOptions) (*Client, error) {
+	if opts.PeerToPeer && opts.Address == "" {
+		return nil, errors.New("peer-to-peer connections require an address")
+	}
+
+	if opts.ReconnectInterval <= 0 {
+		opts.ReconnectInterval = DefaultReconnectInterval
+	}
+
+	if opts.ReconnectTimeout <= 0 {
+		opts.ReconnectTimeout = DefaultReconnectTimeout
+	}
+
+	c := &Client{
+		opts:     opts,
+		done:     make(chan struct{}),
+		ready:    make(chan struct{}),
+		signals:  make(map[chan<- *dbus.Signal]*signalTarget),
+		matches:  make(map[string]*matchRule),
+		sessions: make(map[*session]struct{}),
+	}
+
+	shared := !opts.Private && !opts.PeerToPeer && opts.Address == ""
+	conn, err := c.dial(shared)
+	if err != nil {
+		return nil, err
+	}
+
+	c.attach(conn, shared)
+
+	if opts.WatchProvider {
+		var ctx context.Context
+		ctx, c.cancel = context.WithCancel(context.Background())
+
+		if c.watcher, err = newProviderWatcher(ctx, c); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ConnectSecretService connects to the secret service as configured by opts
+// and returns a client to it together with the Client that must be closed by
+// the caller
+func ConnectSecretService(opts ConnectOptions) (SecretService, *Client, error) {
+	client, err := Connect(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	svc, err := client.SecretService()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	return svc, client, nil
+}
+
+// dial opens a new connection to the bus
+func (c *Client) dial(shared bool) (*dbus.Conn, error) {
+	if shared {
+		return dbus.SessionBus()
+	}
+
+	var conn *dbus.Conn
+	var err error
+
+	if c.opts.Address != "" {
+		conn, err = dbus.Dial(c.opts.Address)
+	} else {
+		conn, err = dbus.SessionBusPrivate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !c.opts.PeerToPeer {
+		if err := conn.Hello(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// attach makes conn the current connection of c
+func (c *Client) attach(conn *dbus.Conn, shared bool) {
+	in := make(chan *dbus.Signal, 64)
+	stop := make(chan struct{})
+	conn.Signal(in)
+	go c.dispatch(in, stop)
+
+	c.l.Lock()
+	c.conn = conn
+	c.shared = shared
+	c.detach = func() {
+		conn.RemoveSignal(in)
+		close(stop)
+	}
+	close(c.ready)
+	c.l.Unlock()
+
+	if c.opts.Reconnect {
+		go c.watch(conn)
+	}
+}
+
+// watch waits for conn to be closed and re-establishes the connection
+func (c *Client) watch(conn *dbus.Conn) {
+	select {
+	case <-c.done:
+		return
+	case <-conn.Context().Done():
+	}
+
+	var detach func()
+
+	c.l.Lock()
+	if c.conn == conn {
+		c.conn = nil
+		c.ready = make(chan struct{})
+		detach, c.detach = c.detach, nil
+	}
+	c.l.Unlock()
+
+	if detach != nil {
+		detach()
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(c.opts.ReconnectInterval):
+		}
+
+		next, err := c.dial(false)
+		if err != nil {
+			continue
+		}
+
+		if err := c.restore(next); err != nil {
+			next.Close()
+			continue
+		}
+
+		c.l.Lock()
+		closed := c.closed
+		c.l.Unlock()
+
+		if closed {
+			next.Close()
+			return
+		}
+
+		c.attach(next, false)
+		return
+	}
+}
+
+// restore registers the match rules of c on conn and re-opens all sessions
+func (c *Client) restore(conn *dbus.Conn) error {
+	c.l.Lock()
+	rules := make([]*matchRule, 0, len(c.matches))
+	for _, r := range c.matches {
+		rules = append(rules, r)
+	}
+	sessions := make([]*session, 0, len(c.sessions))
+	for s := range c.sessions {
+		sessions = append(sessions, s)
+	}
+	c.l.Unlock()
+
+	if !c.opts.PeerToPeer {
+		for _, r := range rules {
+			if err := conn.AddMatchSignal(r.options...); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, s := range sessions {
+		if err := s.reopen(conn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dispatch delivers the signals received on in to all channels registered
+// using Signal until in is closed or stop is closed
+func (c *Client) dispatch(in chan *dbus.Signal, stop chan struct{}) {
+	for {
+		select {
+		case s, ok := <-in:
+			if !ok {
+				return
+			}
+
+			c.l.Lock()
+			for _, t := range c.signals {
+				t.push(s)
+			}
+			c.l.Unlock()
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+// current returns the current connection and waits for a lost connection
+// to be re-established
+func (c *Client) current(ctx context.Context) (*dbus.Conn, error) {
+	c.l.Lock()
+	conn, ready, closed := c.conn, c.ready, c.closed
+	c.l.Unlock()
+
+	if closed {
+		return nil, dbus.ErrClosed
+	}
+
+	if conn != nil {
+		return conn, nil
+	}
+
+	timer := time.NewTimer(c.opts.ReconnectTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return c.current(ctx)
+	case <-c.done:
+		return nil, dbus.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("not connected: reconnect timed out after %s", c.opts.ReconnectTimeout)
+	}
+}
+
+// Conn returns the current connection or nil if the connection is being
+// re-established
+func (c *Client) Conn() *dbus.Conn {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return c.conn
+}
+
+// SecretService returns a client to the SecretService using c. If
+// ConnectOptions.Activation is set the secret service is activated on the
+// first call that fails because it is not available
+func (c *Client) SecretService() (SecretService, error) {
+	var conn busConn = c
+	if c.watcher != nil {
+		conn = c.watcher
+	}
+
+	if c.opts.Recorder != nil {
+		conn = newRecordingConn(conn, c.opts.Recorder)
+	}
+
+	if c.opts.Activation != nil {
+		conn = &activatingConn{
+			connWrapper: connWrapper{conn},
+			opts:        c.opts.Activation.withDefaults(),
+		}
+	}
+
+	if c.opts.Audit != nil {
+		conn = newAuditingConn(conn, *c.opts.Audit)
+	}
+
+	if c.opts.Observer != nil {
+		conn = newObservingConn(conn, c.opts.Observer)
+	}
+
+	return newSecretService(conn)
+}
+
+// Object returns the object identified by dest and path. Calls are sent on
+// the current connection of c
+func (c *Client) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	return &clientObject{
+		client: c,
+		dest:   dest,
+		path:   path,
+	}
+}
+
+// Signal registers ch to receive all signals. Unlike (*dbus.Conn).Signal, ch
+// is not closed if the connection is lost or c is closed
+func (c *Client) Signal(ch chan<- *dbus.Signal) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if _, ok := c.signals[ch]; !ok {
+		c.signals[ch] = newSignalTarget(ch)
+	}
+}
+
+// RemoveSignal removes ch from the channels registered using Signal
+func (c *Client) RemoveSignal(ch chan<- *dbus.Signal) {
+	c.l.Lock()
+	t, ok := c.signals[ch]
+	delete(c.signals, ch)
+	c.l.Unlock()
+
+	if ok {
+		t.stop()
+	}
+}
+
+// AddMatchSignal registers a match rule on the bus. The rule is registered
+// again after the connection has been re-established
+func (c *Client) AddMatchSignal(options ...dbus.MatchOption) error {
+	if !c.opts.PeerToPeer {
+		conn, err := c.current(context.Background())
+		if err != nil {
+			return err
+		}
+
+		if err := conn.AddMatchSignal(options...); err != nil {
+			return err
+		}
+	}
+
+	key := fmt.Sprint(options)
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	r, ok := c.matches[key]
+	if !ok {
+		r = &matchRule{options: options}
+		c.matches[key] = r
+	}
+	r.refs++
+
+	return nil
+}
+
+// RemoveMatchSignal removes a match rule registered using AddMatchSignal
+func (c *Client) RemoveMatchSignal(options ...dbus.MatchOption) error {
+	key := fmt.Sprint(options)
+
+	c.l.Lock()
+	if r, ok := c.matches[key]; ok {
+		r.refs--
+		if r.refs == 0 {
+			delete(c.matches, key)
+		}
+	}
+	c.l.Unlock()
+
+	if c.opts.PeerToPeer {
+		return nil
+	}
+
+	conn, err := c.current(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return conn.RemoveMatchSignal(options...)
+}
+
+// trackSession implements sessionTracker
+func (c *Client) trackSession(s *session) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.sessions[s] = struct{}{}
+}
+
+// untrackSession implements sessionTracker
+func (c *Client) untrackSession(s *session) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	delete(c.sessions, s)
+}
+
+// onClose implements closeNotifier. fn is called right away if c has already
+// been closed
+func (c *Client) onClose(fn func()) {
+	c.l.Lock()
+	closed := c.closed
+	if !closed {
+		c.closers = append(c.closers, fn)
+	}
+	c.l.Unlock()
+
+	if closed {
+		fn()
+	}
+}
+
+// Close stops reconnecting and closes the connection unless it is the shared
+// session bus connection. The signal channel and match rules registered by c
+// are removed from the shared connection instead
+func (c *Client) Close() error {
+	c.l.Lock()
+	if c.closed {
+		c.l.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	conn, shared, detach := c.conn, c.shared, c.detach
+	c.conn = nil
+	c.detach = nil
+	signals := c.signals
+	c.signals = make(map[chan<- *dbus.Signal]*signalTarget)
+	matches := c.matches
+	c.matches = make(map[string]*matchRule)
+	closers := c.closers
+	c.closers = nil
+	c.l.Unlock()
+
+	for _, fn := range closers {
+		fn()
+	}
+
+	for _, t := range signals {
+		t.stop()
+	}
+
+	if detach != nil {
+		detach()
+	}
+
+	if conn == nil {
+		return nil
+	}
+
+	if !shared {
+		return conn.Close()
+	}
+
+	// the shared connection stays open, remove everything registered on it
+	for _, r := range matches {
+		for i := 0; i < r.refs; i++ {
+			conn.RemoveMatchSignal(r.options...)
+		}
+	}
+
+	return nil
+}
+
+// clientObject implements dbus.BusObject on the current connection of a Client
+type clientObject struct {
+	client *Client
+	dest   string
+	path   dbus.ObjectPath
+}
+
+// object returns the dbus.BusObject on the current connection
+func (o *clientObject) object(ctx context.Context) (dbus.BusObject, *dbus.Conn, error) {
+	conn, err := o.client.current(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conn.Object(o.dest, o.path), conn, nil
+}
+
+// Call implements dbus.BusObject
+func (o *clientObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return o.CallWithContext(context.Background(), method, flags, args...)
+}
+
+// CallWithContext implements dbus.BusObject. Calls that could not be sent
+// because the connection has been closed are retried after reconnecting
+func (o *clientObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	for {
+		obj, conn, err := o.object(ctx)
+		if err != nil {
+			return &dbus.Call{Err: err}
+		}
+
+		call := obj.CallWithContext(ctx, method, flags, args...)
+		if call.Err != dbus.ErrClosed || !o.client.opts.Reconnect {
+			return call
+		}
+
+		// wait for watch to notice the closed connection
+		select {
+		case <-conn.Context().Done():
+		case <-ctx.Done():
+			return &dbus.Call{Err: ctx.Err()}
+		}
+	}
+}
+
+// Go implements dbus.BusObject
+func (o *clientObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.GoWithContext(context.Background(), method, flags, ch, args...)
+}
+
+// GoWithContext implements dbus.BusObject
+func (o *clientObject) GoWithContext(ctx context.Context, method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	obj, _, err := o.object(ctx)
+	if err != nil {
+		if ch == nil {
+			ch = make(chan *dbus.Call, 1)
+		}
+		call := &dbus.Call{Err: err, Done: ch}
+		ch <- call
+		return call
+	}
+
+	return obj.GoWithContext(ctx, method, flags, ch, args...)
+}
+
+// AddMatchSignal implements dbus.BusObject
+func (o *clientObject) AddMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	options = append([]dbus.MatchOption{
+		dbus.WithMatchInterface(iface),
+		dbus.WithMatchMember(member),
+	}, options...)
+
+	return &dbus.Call{Err: o.client.AddMatchSignal(options...)}
+}
+
+// RemoveMatchSignal implements dbus.BusObject
+func (o *clientObject) RemoveMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	options = append([]dbus.MatchOption{
+		dbus.WithMatchInterface(iface),
+		dbus.WithMatchMember(member),
+	}, options...)
+
+	return &dbus.Call{Err: o.client.RemoveMatchSignal(options...)}
+}
+
+// GetProperty implements dbus.BusObject
+func (o *clientObject) GetProperty(p string) (dbus.Variant, error) {
+	return getProperty(o.CallWithContext, p)
+}
+
+// SetProperty implements dbus.BusObject
+func (o *clientObject) SetProperty(p string, v interface{}) error {
+	return setProperty(o.CallWithContext, p, v)
+}
+
+// Destination implements dbus.BusObject
+func (o *clientObject) Destination() string {
+	return o.dest
+}
+
+// Path implements dbus.BusObject
+func (o *clientObject) Path() dbus.ObjectPath {
+	return o.path
+}
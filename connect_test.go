@@ -0,0 +1,305 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring_test
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+// startBus starts a private bus and serves svc on it unless svc is nil. The
+// test is skipped if dbus-daemon is not installed
+func startBus(t *testing.T, svc *keyringfake.Service) *keyringfake.Bus {
+	t.Helper()
+
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	bus, err := keyringfake.StartBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if svc != nil {
+		if err := bus.Serve(svc); err != nil {
+			bus.Close()
+			t.Fatal(err)
+		}
+	}
+
+	return bus
+}
+
+// waitSignal waits for the signal name emitted by path on ch. Any path
+// matches if path is empty
+func waitSignal(t *testing.T, ch <-chan *dbus.Signal, name string, path dbus.ObjectPath) {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case sig := <-ch:
+			if sig.Name == name && (path == "" || sig.Path == path) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("%s for %s not received", name, path)
+		}
+	}
+}
+
+// matchRules returns the number of match rules conn has registered on the
+// bus. The test is skipped if the bus does not support statistics
+func matchRules(t *testing.T, conn *dbus.Conn) uint32 {
+	t.Helper()
+
+	var stats map[string]dbus.Variant
+	err := conn.BusObject().Call("org.freedesktop.DBus.Debug.Stats.GetConnectionStats", 0, conn.Names()[0]).Store(&stats)
+	if err != nil {
+		t.Skipf("bus statistics not supported: %s", err)
+	}
+
+	n, _ := stats["MatchRules"].Value().(uint32)
+	return n
+}
+
+var itemCreated = []dbus.MatchOption{
+	dbus.WithMatchInterface(keyring.CollectionInterface),
+	dbus.WithMatchMember("ItemCreated"),
+}
+
+func TestClientReconnect(t *testing.T) {
+	bus := startBus(t, keyringfake.New())
+	defer bus.Close()
+
+	client, err := keyring.Connect(keyring.ConnectOptions{
+		Address:           bus.Address,
+		Reconnect:         true,
+		ReconnectInterval: 10 * time.Millisecond,
+		ReconnectTimeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	svc, err := client.SecretService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := svc.GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	client.Signal(signals)
+
+	if err := client.AddMatchSignal(itemCreated...); err != nil {
+		t.Fatal(err)
+	}
+
+	lost := client.Conn()
+	before := session.Path()
+	lost.Close()
+
+	// the next call waits for the connection to be re-established
+	if _, err := col.GetLabel(); err != nil {
+		t.Fatalf("call after reconnect failed: %s", err)
+	}
+
+	if conn := client.Conn(); conn == nil || conn == lost {
+		t.Fatalf("expected a new connection")
+	}
+
+	if session.Path() == before {
+		t.Errorf("expected the session to be re-opened")
+	}
+
+	item, err := col.CreateItem(session.Path(), "db", map[string]string{"service": "db"}, keyring.SecretValue("hunter2"), "text/plain", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitSignal(t, signals, keyring.CollectionInterface+".ItemCreated", col.Path())
+
+	secret, err := item.GetSecret(session.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret.Value.Reveal() != "hunter2" {
+		t.Errorf("unexpected secret after reconnect")
+	}
+
+	current := client.Conn()
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-current.Context().Done():
+	default:
+		t.Errorf("expected the private connection to be closed")
+	}
+
+	if client.Conn() != nil {
+		t.Errorf("expected no connection after Close")
+	}
+}
+
+func TestClientCloseShared(t *testing.T) {
+	bus := startBus(t, keyringfake.New())
+	defer bus.Close()
+
+	defer os.Setenv("DBUS_SESSION_BUS_ADDRESS", os.Getenv("DBUS_SESSION_BUS_ADDRESS"))
+	os.Setenv("DBUS_SESSION_BUS_ADDRESS", bus.Address)
+
+	shared, err := dbus.SessionBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := matchRules(t, shared)
+	goroutines := runtime.NumGoroutine()
+
+	client, err := keyring.Connect(keyring.ConnectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Conn() != shared {
+		t.Fatalf("expected the shared session bus connection")
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	client.Signal(signals)
+
+	if err := client.AddMatchSignal(itemCreated...); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := matchRules(t, shared); n != rules+1 {
+		t.Errorf("expected %d match rules but got %d", rules+1, n)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := matchRules(t, shared); n != rules {
+		t.Errorf("expected %d match rules after Close but got %d", rules, n)
+	}
+
+	// the dispatcher and the signal target stop asynchronously
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("expected %d goroutines after Close but got %d", goroutines, n)
+	}
+
+	if err := shared.BusObject().Call("org.freedesktop.DBus.GetId", 0).Err; err != nil {
+		t.Errorf("shared connection unusable after Close: %s", err)
+	}
+}
+
+// serve serves svc on a new connection to bus. Closing the connection
+// simulates the provider exiting
+func serve(t *testing.T, bus *keyringfake.Bus, svc *keyringfake.Service) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Dial(bus.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+
+	if err := svc.Serve(conn); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func TestConnectActivation(t *testing.T) {
+	bus := startBus(t, nil)
+	defer bus.Close()
+
+	client, err := keyring.Connect(keyring.ConnectOptions{
+		Address: bus.Address,
+		Activation: &keyring.ActivationOptions{
+			Start:   true,
+			Timeout: 5 * time.Second,
+			Backoff: 10 * time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	svc, err := client.SecretService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the provider is not activatable and claims the name later
+	started := make(chan *dbus.Conn, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+
+		conn, err := dbus.Dial(bus.Address)
+		if err == nil {
+			err = conn.Auth(nil)
+		}
+		if err == nil {
+			err = conn.Hello()
+		}
+		if err == nil {
+			err = keyringfake.New().Serve(conn)
+		}
+		if err != nil {
+			t.Errorf("failed to start the provider: %s", err)
+		}
+		started <- conn
+	}()
+
+	col, err := svc.GetDefaultCollection()
+	if err != nil {
+		t.Fatalf("expected the call to wait for the provider but got %s", err)
+	}
+
+	if label, err := col.GetLabel(); err != nil || label != keyring.DefaultCollectionLabel {
+		t.Errorf("unexpected default collection %q: %v", label, err)
+	}
+
+	(<-started).Close()
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// attrRefPrefix is the prefix of secret references that search by attributes
+const attrRefPrefix = "attr:"
+
+// SecretRefError is returned if the secret referenced by an environment
+// variable or a struct field cannot be resolved
+type SecretRefError struct {
+	// Name is the name of the variable or field
+	Name string
+
+	// Err is the error encountered while resolving the reference
+	Err error
+}
+
+// Error implements the error interface
+func (e *SecretRefError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error encountered while resolving the reference
+func (e *SecretRefError) Unwrap() error {
+	return e.Err
+}
+
+// ParseAttributeRef parses a secret reference in the form "attr:key=value,key=value"
+// into the attributes to search for
+func ParseAttributeRef(ref string) (map[string]string, error) {
+	if !strings.HasPrefix(ref, attrRefPrefix) {
+		return nil, fmt.Errorf("unsupported secret reference %q", ref)
+	}
+
+	return parseAttributeList(strings.TrimPrefix(ref, attrRefPrefix))
+}
+
+// parseAttributeList parses "key=value,key=value"
+func parseAttributeList(s string) (map[string]string, error) {
+	attrs := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+
+		idx := strings.Index(pair, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid attribute %q: expected key=value", pair)
+		}
+
+		attrs[pair[:idx]] = pair[idx+1:]
+	}
+
+	if len(attrs) == 0 {
+		return nil, fmt.Errorf("no attributes in %q", s)
+	}
+
+	return attrs, nil
+}
+
+// ResolveEnv resolves mapping, which maps environment variable names to secret
+// references like "attr:service=db,user=app" or secret URIs (see SecretURI), and
+// returns the variables in the form "NAME=secret". Locked items are unlocked as
+// required. If more than one item matches an "attr:" reference the first one
+// returned by SearchAndRetrieve is used
+func ResolveEnv(ctx context.Context, svc SecretService, mapping map[string]string) ([]string, error) {
+	session, err := svc.OpenSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	env := make([]string, 0, len(mapping))
+	for name, ref := range mapping {
+		if strings.HasPrefix(ref, URIScheme+":") {
+			secret, err := Resolve(ctx, svc, ref)
+			if err != nil {
+				return nil, &SecretRefError{Name: name, Err: err}
+			}
+
+			env = append(env, name+"="+secret.Value.Reveal())
+			continue
+		}
+
+		attrs, err := ParseAttributeRef(ref)
+		if err != nil {
+			return nil, &SecretRefError{Name: name, Err: err}
+		}
+
+		value, err := lookupAttributes(ctx, svc, session, attrs)
+		if err != nil {
+			return nil, &SecretRefError{Name: name, Err: err}
+		}
+
+		env = append(env, name+"="+string(value))
+	}
+
+	return env, nil
+}
+
+// lookupAttributes returns the secret of the first item matching attrs. Locked
+// items are unlocked as required
+func lookupAttributes(ctx context.Context, svc SecretService, session Session, attrs map[string]string) ([]byte, error) {
+	results, err := svc.SearchAndRetrieve(ctx, attrs, RetrieveOptions{
+		Session: session,
+		Unlock:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, res := range results {
+		if res.Secret != nil {
+			return res.Secret.Value.Bytes(), nil
+		}
+	}
+
+	return nil, ErrNoSuchItem
+}
+
+// Exec resolves mapping using ResolveEnv, adds the variables to the environment
+// of cmd and runs it. If cmd.Env is nil the environment of the current process
+// is used as the base. Secrets are only passed through the environment of the
+// child and are never written to disk or added to its arguments
+func Exec(ctx context.Context, svc SecretService, mapping map[string]string, cmd *exec.Cmd) error {
+	if err := StartExec(ctx, svc, mapping, cmd); err != nil {
+		return err
+	}
+
+	return cmd.Wait()
+}
+
+// StartExec is like Exec but only starts cmd. The caller must call cmd.Wait
+func StartExec(ctx context.Context, svc SecretService, mapping map[string]string, cmd *exec.Cmd) error {
+	env, err := ResolveEnv(ctx, svc, mapping)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+
+	return cmd.Start()
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseAttributeRef(t *testing.T) {
+	cases := []struct {
+		ref      string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			ref:      "attr:service=db",
+			expected: map[string]string{"service": "db"},
+		},
+		{
+			ref:      "attr:service=db,user=app",
+			expected: map[string]string{"service": "db", "user": "app"},
+		},
+		{
+			ref:      "attr:service=db,,user=",
+			expected: map[string]string{"service": "db", "user": ""},
+		},
+		{
+			ref:      "attr:url=https://host/?a=b",
+			expected: map[string]string{"url": "https://host/?a=b"},
+		},
+		{
+			ref: "service=db",
+			err: true,
+		},
+		{
+			ref: "attr:",
+			err: true,
+		},
+		{
+			ref: "attr:service",
+			err: true,
+		},
+		{
+			ref: "attr:=db",
+			err: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.ref, func(t *testing.T) {
+			attrs, err := ParseAttributeRef(c.ref)
+			if (err != nil) != c.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if !reflect.DeepEqual(attrs, c.expected) {
+				t.Errorf("expected %v but got %v", c.expected, attrs)
+			}
+		})
+	}
+}
+
+// sessionService is a SecretService that only supports opening sessions
+type sessionService struct {
+	SecretService
+}
+
+func (sessionService) OpenSession() (Session, error) { return nopSession{}, nil }
+
+// nopSession is a Session that can only be closed
+type nopSession struct {
+	Session
+}
+
+func (nopSession) Close() error { return nil }
+
+func TestResolveEnvInvalidRef(t *testing.T) {
+	_, err := ResolveEnv(context.Background(), sessionService{}, map[string]string{
+		"DB_PASSWORD": "attr:service",
+	})
+
+	refErr, ok := err.(*SecretRefError)
+	if !ok {
+		t.Fatalf("expected a *SecretRefError but got %T: %v", err, err)
+	}
+
+	if refErr.Name != "DB_PASSWORD" || refErr.Err == nil {
+		t.Errorf("expected the error to name DB_PASSWORD but got %+v", refErr)
+	}
+}
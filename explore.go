@@ -0,0 +1,171 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+// ObjectKind classifies objects discovered by Explore
+type ObjectKind string
+
+// Object kinds reported by Explore
+const (
+	KindService    ObjectKind = "service"
+	KindCollection ObjectKind = "collection"
+	KindItem       ObjectKind = "item"
+	KindSession    ObjectKind = "session"
+	KindPrompt     ObjectKind = "prompt"
+	KindUnknown    ObjectKind = "unknown"
+)
+
+// ExploredObject describes an object discovered by Explore
+type ExploredObject struct {
+	// Path is the ObjectPath of the object
+	Path dbus.ObjectPath
+
+	// Kind classifies the object based on the interfaces it implements
+	Kind ObjectKind
+
+	// Interfaces lists all interfaces reported by introspection
+	Interfaces []string
+
+	// Collection is set if Kind is KindCollection
+	Collection Collection
+
+	// Item is set if Kind is KindItem
+	Item Item
+
+	// Session is set if Kind is KindSession
+	Session Session
+
+	// Prompt is set if Kind is KindPrompt
+	Prompt Prompt
+
+	// Err holds any error that occurred while introspecting the object or
+	// creating a client for it. Objects that could not be introspected have
+	// the kind KindUnknown and their children are not explored
+	Err error
+}
+
+// Explore walks the object tree of the secret service starting at SecretServicePath
+// using org.freedesktop.DBus.Introspectable and returns all objects found. Unlike
+// the Collections property this also returns objects like SessionCollection or alias
+// paths. Objects that do not implement any Secret Service interface are skipped.
+// An error is only returned if SecretServicePath cannot be introspected, errors
+// of other objects are reported in ExploredObject.Err. svc must be returned by
+// this package, for example by GetSecretService or Client.SecretService; its
+// connection including any wrapping (auditing, observing, ...) is used for
+// all calls and by the returned objects
+func Explore(svc SecretService) ([]*ExploredObject, error) {
+	s, ok := svc.(*service)
+	if !ok {
+		return nil, fmt.Errorf("Explore: unsupported SecretService implementation %T", svc)
+	}
+	conn := s.conn
+
+	node, err := introspectPath(conn, SecretServicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*ExploredObject
+	explore(conn, SecretServicePath, node, &objects)
+
+	return objects, nil
+}
+
+// introspectPath introspects the object at path
+func introspectPath(conn busConn, path dbus.ObjectPath) (*introspect.Node, error) {
+	node, err := introspect.Call(conn.Object(SecretServiceDest, path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect %s: %s", path, err)
+	}
+
+	return node, nil
+}
+
+// explore adds the object at path described by node to objects and descends
+// into all children
+func explore(conn busConn, path dbus.ObjectPath, node *introspect.Node, objects *[]*ExploredObject) {
+
+	if len(node.Interfaces) > 0 {
+		obj := &ExploredObject{
+			Path: path,
+		}
+
+		for _, iface := range node.Interfaces {
+			obj.Interfaces = append(obj.Interfaces, iface.Name)
+		}
+
+		obj.Kind = classify(obj.Interfaces)
+
+		switch obj.Kind {
+		case KindCollection:
+			obj.Collection, obj.Err = newCollection(conn, path)
+		case KindItem:
+			obj.Item, obj.Err = newItem(conn, path)
+		case KindSession:
+			obj.Session, obj.Err = newSession(conn, path)
+		case KindPrompt:
+			obj.Prompt = newPrompt(conn, path)
+		}
+
+		if obj.Kind != KindUnknown || hasSecretInterface(obj.Interfaces) {
+			*objects = append(*objects, obj)
+		}
+	}
+
+	for _, child := range node.Children {
+		childPath := dbus.ObjectPath(strings.TrimSuffix(string(path), "/") + "/" + child.Name)
+
+		childNode, err := introspectPath(conn, childPath)
+		if err != nil {
+			*objects = append(*objects, &ExploredObject{
+				Path: childPath,
+				Kind: KindUnknown,
+				Err:  err,
+			})
+			continue
+		}
+
+		explore(conn, childPath, childNode, objects)
+	}
+}
+
+// classify returns the ObjectKind for the given list of interfaces
+func classify(interfaces []string) ObjectKind {
+	for _, iface := range interfaces {
+		switch iface {
+		case ServiceInterface:
+			return KindService
+		case CollectionInterface:
+			return KindCollection
+		case ItemInterface:
+			return KindItem
+		case SessionInterface:
+			return KindSession
+		case PromptInterface:
+			return KindPrompt
+		}
+	}
+
+	return KindUnknown
+}
+
+// hasSecretInterface returns true if any of interfaces belongs to the
+// Secret Service API
+func hasSecretInterface(interfaces []string) bool {
+	for _, iface := range interfaces {
+		if strings.HasPrefix(iface, SecretServicePrefix) {
+			return true
+		}
+	}
+
+	return false
+}
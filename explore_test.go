@@ -0,0 +1,74 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring_test
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+func TestExploreClient(t *testing.T) {
+	bus := startBus(t, keyringfake.New())
+	defer bus.Close()
+
+	client, err := keyring.Connect(keyring.ConnectOptions{Address: bus.Address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	svc, err := client.SecretService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := svc.GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := col.CreateItem(session.Path(), "db", map[string]string{"service": "db"}, keyring.SecretValue("x"), "text/plain", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := keyring.Explore(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := make(map[dbus.ObjectPath]keyring.ObjectKind)
+	for _, obj := range objects {
+		if obj.Err != nil {
+			t.Errorf("%s: %s", obj.Path, obj.Err)
+		}
+		kinds[obj.Path] = obj.Kind
+	}
+
+	expected := map[dbus.ObjectPath]keyring.ObjectKind{
+		keyring.SecretServicePath: keyring.KindService,
+		col.Path():                keyring.KindCollection,
+		item.Path():               keyring.KindItem,
+	}
+
+	for path, kind := range expected {
+		if kinds[path] != kind {
+			t.Errorf("expected %s to be a %s but got %q", path, kind, kinds[path])
+		}
+	}
+}
+
+func TestExploreUnsupportedService(t *testing.T) {
+	if _, err := keyring.Explore(keyringfake.New()); err == nil {
+		t.Errorf("expected an error for a SecretService not backed by a connection")
+	}
+}
@@ -0,0 +1,701 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// RedactedSecretValue replaces the values of secrets in fixtures
+const RedactedSecretValue = "<redacted>"
+
+// Kinds of recorded interactions
+const (
+	InteractionCall   = "call"
+	InteractionSignal = "signal"
+)
+
+// secretSignature is the DBus signature of a Secret. The third field holds
+// the secret value and is redacted in fixtures
+const secretSignature = "(oayays)"
+
+// Fixture holds the DBus interactions recorded by a Recorder. It is
+// stored as JSON with all secret values redacted
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a method call and its reply or a signal received from the
+// secret service
+type Interaction struct {
+	// Kind is InteractionCall or InteractionSignal
+	Kind string `json:"kind"`
+
+	// Destination is the bus name a method call has been sent to
+	Destination string `json:"destination,omitempty"`
+
+	// Path is the object path of the called object or of the signal sender
+	Path dbus.ObjectPath `json:"path"`
+
+	// Method is the interface-qualified name of the method or signal
+	Method string `json:"method"`
+
+	// Args holds the arguments of the call or the body of the signal
+	Args []FixtureValue `json:"args,omitempty"`
+
+	// Result holds the body of the reply to a call
+	Result []FixtureValue `json:"result,omitempty"`
+
+	// Error is set if the call failed
+	Error *FixtureError `json:"error,omitempty"`
+}
+
+// FixtureValue is a DBus value together with its signature
+type FixtureValue struct {
+	Signature string          `json:"sig"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// FixtureError is an error returned by a recorded call. Name is empty for
+// errors that are not DBus errors
+type FixtureError struct {
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// ReadFixture reads a fixture from r
+func ReadFixture(r io.Reader) (*Fixture, error) {
+	var f Fixture
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// LoadFixture reads the fixture stored at path
+func LoadFixture(path string) (*Fixture, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadFixture(bytes.NewReader(blob))
+}
+
+// WriteTo writes f to w as indented JSON
+func (f *Fixture) WriteTo(w io.Writer) (int64, error) {
+	blob, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(append(blob, '\n'))
+	return int64(n), err
+}
+
+// Save writes f to the file at path
+func (f *Fixture) Save(path string) error {
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// encodeValues encodes values as FixtureValues with secret values redacted
+func encodeValues(values []interface{}) ([]FixtureValue, error) {
+	var res []FixtureValue
+	for _, v := range values {
+		fv, err := encodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, fv)
+	}
+
+	return res, nil
+}
+
+// encodeValue encodes v as a FixtureValue with secret values redacted
+func encodeValue(v interface{}) (FixtureValue, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return FixtureValue{}, errors.New("cannot encode nil value")
+	}
+
+	sig, err := signatureOf(rv)
+	if err != nil {
+		return FixtureValue{}, err
+	}
+
+	j, err := encodeJSON(sig, rv)
+	if err != nil {
+		return FixtureValue{}, err
+	}
+
+	blob, err := json.Marshal(j)
+	if err != nil {
+		return FixtureValue{}, err
+	}
+
+	return FixtureValue{
+		Signature: sig,
+		Value:     blob,
+	}, nil
+}
+
+// decodeValues decodes values into the types a DBus reply body would hold
+func decodeValues(values []FixtureValue) ([]interface{}, error) {
+	res := make([]interface{}, 0, len(values))
+	for _, fv := range values {
+		dec := json.NewDecoder(bytes.NewReader(fv.Value))
+		dec.UseNumber()
+
+		var j interface{}
+		if err := dec.Decode(&j); err != nil {
+			return nil, err
+		}
+
+		v, err := decodeJSON(fv.Signature, j)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, v.Interface())
+	}
+
+	return res, nil
+}
+
+var (
+	variantType     = reflect.TypeOf(dbus.Variant{})
+	objectPathType  = reflect.TypeOf(dbus.ObjectPath(""))
+	signatureType   = reflect.TypeOf(dbus.Signature{})
+	interfacesType  = reflect.TypeOf([]interface{}{})
+	basicSignatures = map[reflect.Kind]string{
+		reflect.Uint8:   "y",
+		reflect.Bool:    "b",
+		reflect.Int16:   "n",
+		reflect.Uint16:  "q",
+		reflect.Int32:   "i",
+		reflect.Uint32:  "u",
+		reflect.Int64:   "x",
+		reflect.Uint64:  "t",
+		reflect.Float64: "d",
+		reflect.String:  "s",
+	}
+	basicTypes = map[byte]reflect.Type{
+		'y': reflect.TypeOf(byte(0)),
+		'b': reflect.TypeOf(false),
+		'n': reflect.TypeOf(int16(0)),
+		'q': reflect.TypeOf(uint16(0)),
+		'i': reflect.TypeOf(int32(0)),
+		'u': reflect.TypeOf(uint32(0)),
+		'x': reflect.TypeOf(int64(0)),
+		't': reflect.TypeOf(uint64(0)),
+		'd': reflect.TypeOf(float64(0)),
+		's': reflect.TypeOf(""),
+		'o': objectPathType,
+		'g': signatureType,
+		'v': variantType,
+	}
+)
+
+// signatureOf returns the DBus signature of v. Unlike dbus.SignatureOf it
+// treats []interface{} as a struct like the DBus decoder does. Empty arrays
+// of such structs get the placeholder signature "()"
+func signatureOf(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", errors.New("cannot encode nil value")
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Type() == variantType:
+		return "v", nil
+	case v.Type() == objectPathType:
+		return "o", nil
+	case v.Type() == signatureType:
+		return "g", nil
+	case v.Type() == interfacesType:
+		sig := "("
+		for i := 0; i < v.Len(); i++ {
+			s, err := signatureOf(v.Index(i))
+			if err != nil {
+				return "", err
+			}
+			sig += s
+		}
+		return sig + ")", nil
+	}
+
+	if sig, ok := basicSignatures[v.Kind()]; ok {
+		return sig, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Len() > 0 {
+			s, err := signatureOf(v.Index(0))
+			return "a" + s, err
+		}
+		s, err := signatureOfType(v.Type().Elem())
+		return "a" + s, err
+
+	case reflect.Map:
+		k, err := signatureOfType(v.Type().Key())
+		if err != nil {
+			return "", err
+		}
+
+		if v.Len() > 0 {
+			s, err := signatureOf(v.MapIndex(v.MapKeys()[0]))
+			return "a{" + k + s + "}", err
+		}
+
+		s, err := signatureOfType(v.Type().Elem())
+		return "a{" + k + s + "}", err
+
+	case reflect.Struct:
+		sig := "("
+		for _, f := range exportedFields(v) {
+			s, err := signatureOf(f)
+			if err != nil {
+				return "", err
+			}
+			sig += s
+		}
+		return sig + ")", nil
+	}
+
+	return "", fmt.Errorf("cannot encode value of type %s", v.Type())
+}
+
+// signatureOfType returns the DBus signature of values of type t
+func signatureOfType(t reflect.Type) (string, error) {
+	if t == interfacesType {
+		return "()", nil
+	}
+
+	if t.Kind() == reflect.Interface {
+		return "v", nil
+	}
+
+	return signatureOf(reflect.Zero(t))
+}
+
+// exportedFields returns the fields of the struct v that are sent on the bus
+func exportedFields(v reflect.Value) []reflect.Value {
+	var fields []reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" || f.Tag.Get("dbus") == "-" {
+			continue
+		}
+		fields = append(fields, v.Field(i))
+	}
+
+	return fields
+}
+
+// splitSignature splits sig into its complete types
+func splitSignature(sig string) ([]string, error) {
+	var types []string
+	for sig != "" {
+		n, err := typeLength(sig)
+		if err != nil {
+			return nil, err
+		}
+
+		types = append(types, sig[:n])
+		sig = sig[n:]
+	}
+
+	return types, nil
+}
+
+// typeLength returns the length of the first complete type in sig
+func typeLength(sig string) (int, error) {
+	if sig == "" {
+		return 0, errors.New("incomplete signature")
+	}
+
+	switch sig[0] {
+	case 'a':
+		n, err := typeLength(sig[1:])
+		return n + 1, err
+
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+
+		i := 1
+		for i < len(sig) && sig[i] != closing {
+			n, err := typeLength(sig[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+
+		if i == len(sig) {
+			return 0, fmt.Errorf("unterminated signature %q", sig)
+		}
+
+		return i + 1, nil
+	}
+
+	if _, ok := basicTypes[sig[0]]; !ok {
+		return 0, fmt.Errorf("unsupported signature %q", sig)
+	}
+
+	return 1, nil
+}
+
+// encodeJSON converts v with signature sig to a JSON value. Arrays and
+// structs become JSON arrays, maps become arrays of key-value pairs and
+// variants become objects holding the signature and value
+func encodeJSON(sig string, v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	switch sig[0] {
+	case 'v':
+		variant := v.Interface().(dbus.Variant)
+		inner := variant.Signature().String()
+		value, err := encodeJSON(inner, reflect.ValueOf(variant.Value()))
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{
+			"sig":   inner,
+			"value": value,
+		}, nil
+
+	case 'a':
+		if sig[1] == '{' {
+			return encodeMap(sig, v)
+		}
+
+		if sig == "ay" {
+			return v.Bytes(), nil
+		}
+
+		values := []interface{}{}
+		for i := 0; i < v.Len(); i++ {
+			e, err := encodeJSON(sig[1:], v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, e)
+		}
+		return values, nil
+
+	case '(':
+		types, err := splitSignature(sig[1 : len(sig)-1])
+		if err != nil {
+			return nil, err
+		}
+
+		var fields []reflect.Value
+		if v.Kind() == reflect.Struct {
+			fields = exportedFields(v)
+		} else {
+			for i := 0; i < v.Len(); i++ {
+				fields = append(fields, v.Index(i))
+			}
+		}
+
+		if len(fields) != len(types) {
+			return nil, fmt.Errorf("struct does not match signature %q", sig)
+		}
+
+		values := []interface{}{}
+		for i, f := range fields {
+			if sig == secretSignature && i == 2 {
+				values = append(values, []byte(RedactedSecretValue))
+				continue
+			}
+
+			e, err := encodeJSON(types[i], f)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, e)
+		}
+		return values, nil
+
+	case 'g':
+		return v.Interface().(dbus.Signature).String(), nil
+	}
+
+	return v.Interface(), nil
+}
+
+// encodeMap encodes the map v with signature sig as key-value pairs sorted
+// by their encoded keys
+func encodeMap(sig string, v reflect.Value) (interface{}, error) {
+	types, err := splitSignature(sig[2 : len(sig)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	type pair struct {
+		key   string
+		value []interface{}
+	}
+
+	var pairs []pair
+	for _, k := range v.MapKeys() {
+		key, err := encodeJSON(types[0], k)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := encodeJSON(types[1], v.MapIndex(k))
+		if err != nil {
+			return nil, err
+		}
+
+		blob, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, pair{string(blob), []interface{}{key, value}})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+
+	values := []interface{}{}
+	for _, p := range pairs {
+		values = append(values, p.value)
+	}
+
+	return values, nil
+}
+
+// typeOf returns the type the DBus decoder uses for values of signature sig
+func typeOf(sig string) (reflect.Type, error) {
+	switch sig[0] {
+	case '(':
+		return interfacesType, nil
+
+	case 'a':
+		if sig[1] == '{' {
+			types, err := splitSignature(sig[2 : len(sig)-1])
+			if err != nil {
+				return nil, err
+			}
+			if len(types) != 2 {
+				return nil, fmt.Errorf("invalid signature %q", sig)
+			}
+
+			k, err := typeOf(types[0])
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := typeOf(types[1])
+			if err != nil {
+				return nil, err
+			}
+
+			return reflect.MapOf(k, v), nil
+		}
+
+		e, err := typeOf(sig[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		return reflect.SliceOf(e), nil
+	}
+
+	t, ok := basicTypes[sig[0]]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signature %q", sig)
+	}
+
+	return t, nil
+}
+
+// decodeJSON converts the JSON value j produced by encodeJSON back to a
+// value of signature sig
+func decodeJSON(sig string, j interface{}) (reflect.Value, error) {
+	if sig == "" {
+		return reflect.Value{}, errors.New("empty signature")
+	}
+
+	t, err := typeOf(sig)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	switch sig[0] {
+	case 'v':
+		obj, ok := j.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("invalid variant %v", j)
+		}
+
+		inner, _ := obj["sig"].(string)
+		s, err := dbus.ParseSignature(inner)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		v, err := decodeJSON(inner, obj["value"])
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		return reflect.ValueOf(dbus.MakeVariantWithSignature(v.Interface(), s)), nil
+
+	case 'a':
+		if sig == "ay" {
+			s, _ := j.(string)
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(b), nil
+		}
+
+		values, ok := j.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("invalid array %v", j)
+		}
+
+		if sig[1] == '{' {
+			types, _ := splitSignature(sig[2 : len(sig)-1])
+
+			m := reflect.MakeMap(t)
+			for _, p := range values {
+				pair, ok := p.([]interface{})
+				if !ok || len(pair) != 2 {
+					return reflect.Value{}, fmt.Errorf("invalid map entry %v", p)
+				}
+
+				k, err := decodeJSON(types[0], pair[0])
+				if err != nil {
+					return reflect.Value{}, err
+				}
+
+				v, err := decodeJSON(types[1], pair[1])
+				if err != nil {
+					return reflect.Value{}, err
+				}
+
+				m.SetMapIndex(k, v)
+			}
+			return m, nil
+		}
+
+		s := reflect.MakeSlice(t, 0, len(values))
+		for _, e := range values {
+			v, err := decodeJSON(sig[1:], e)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			s = reflect.Append(s, v)
+		}
+		return s, nil
+
+	case '(':
+		types, err := splitSignature(sig[1 : len(sig)-1])
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		values, ok := j.([]interface{})
+		if !ok || len(values) != len(types) {
+			return reflect.Value{}, fmt.Errorf("invalid struct %v", j)
+		}
+
+		fields := make([]interface{}, len(values))
+		for i, e := range values {
+			v, err := decodeJSON(types[i], e)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			fields[i] = v.Interface()
+		}
+		return reflect.ValueOf(fields), nil
+	}
+
+	switch x := j.(type) {
+	case json.Number:
+		return decodeNumber(t, x)
+	case string:
+		if t.Kind() == reflect.String {
+			return reflect.ValueOf(x).Convert(t), nil
+		}
+		if t == signatureType {
+			s, err := dbus.ParseSignature(x)
+			return reflect.ValueOf(s), err
+		}
+	case bool:
+		if t.Kind() == reflect.Bool {
+			return reflect.ValueOf(x), nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot decode %v as %q", j, sig)
+}
+
+// decodeNumber converts n to a value of the numeric type t
+func decodeNumber(t reflect.Type, n json.Number) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Float64:
+		f, err := n.Float64()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetFloat(f)
+
+	case reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := n.Int64()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetInt(i)
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(n.String(), 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetUint(u)
+
+	default:
+		return reflect.Value{}, fmt.Errorf("cannot decode %s as %s", n, t)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestFixtureValues(t *testing.T) {
+	redacted := []byte(RedactedSecretValue)
+
+	cases := []struct {
+		name      string
+		value     interface{}
+		signature string
+		expected  interface{}
+	}{
+		{
+			name:      "string",
+			value:     "label",
+			signature: "s",
+		},
+		{
+			name:      "uint32",
+			value:     uint32(3),
+			signature: "u",
+		},
+		{
+			name:      "object path",
+			value:     dbus.ObjectPath("/org/freedesktop/secrets"),
+			signature: "o",
+		},
+		{
+			name:      "bytes",
+			value:     []byte{0, 1, 255},
+			signature: "ay",
+		},
+		{
+			name:      "object paths",
+			value:     []dbus.ObjectPath{"/a", "/b"},
+			signature: "ao",
+		},
+		{
+			name:      "empty array",
+			value:     []dbus.ObjectPath{},
+			signature: "ao",
+		},
+		{
+			name:      "attributes",
+			value:     map[string]string{"service": "db", "user": "app"},
+			signature: "a{ss}",
+		},
+		{
+			name:      "variant",
+			value:     dbus.MakeVariant(true),
+			signature: "v",
+		},
+		{
+			name: "properties",
+			value: map[string]dbus.Variant{
+				"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant("db"),
+				"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(map[string]string{"service": "db"}),
+			},
+			signature: "a{sv}",
+		},
+		{
+			name: "secret",
+			value: Secret{
+				Session:     "/s",
+				Parameters:  []byte{},
+				Value:       SecretValue("hunter2"),
+				ContentType: "text/plain",
+			},
+			signature: secretSignature,
+			expected:  []interface{}{dbus.ObjectPath("/s"), []byte{}, redacted, "text/plain"},
+		},
+		{
+			name:      "decoded secret",
+			value:     []interface{}{dbus.ObjectPath("/s"), []byte{}, []byte("hunter2"), "text/plain"},
+			signature: secretSignature,
+			expected:  []interface{}{dbus.ObjectPath("/s"), []byte{}, redacted, "text/plain"},
+		},
+		{
+			name: "secrets",
+			value: map[dbus.ObjectPath][]interface{}{
+				"/i": {dbus.ObjectPath("/s"), []byte{}, []byte("hunter2"), "text/plain"},
+			},
+			signature: "a{o" + secretSignature + "}",
+			expected: map[dbus.ObjectPath][]interface{}{
+				"/i": {dbus.ObjectPath("/s"), []byte{}, redacted, "text/plain"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fv, err := encodeValue(c.value)
+			if err != nil {
+				t.Fatalf("failed to encode: %s", err)
+			}
+
+			if fv.Signature != c.signature {
+				t.Errorf("expected signature %q but got %q", c.signature, fv.Signature)
+			}
+
+			if strings.Contains(string(fv.Value), "hunter2") {
+				t.Errorf("secret value not redacted: %s", fv.Value)
+			}
+
+			values, err := decodeValues([]FixtureValue{fv})
+			if err != nil {
+				t.Fatalf("failed to decode %s: %s", fv.Value, err)
+			}
+
+			expected := c.expected
+			if expected == nil {
+				expected = c.value
+			}
+
+			if !reflect.DeepEqual(values, []interface{}{expected}) {
+				t.Errorf("expected %#v but got %#v", expected, values[0])
+			}
+		})
+	}
+}
+
+func TestFixtureEncodeNil(t *testing.T) {
+	if _, err := encodeValue(nil); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestFixtureReadWrite(t *testing.T) {
+	args, err := encodeValues([]interface{}{dbus.ObjectPath("/s"), []byte("hunter2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &Fixture{
+		Interactions: []Interaction{
+			{
+				Kind:        InteractionCall,
+				Destination: SecretServiceDest,
+				Path:        "/org/freedesktop/secrets/collection/login/1",
+				Method:      itemMethodGetSecret,
+				Args:        args,
+				Error:       &FixtureError{Name: ErrorIsLocked, Message: "locked"},
+			},
+			{
+				Kind:   InteractionSignal,
+				Path:   "/org/freedesktop/secrets",
+				Method: "org.freedesktop.Secret.Service.CollectionChanged",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadFixture(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(read, f) {
+		t.Errorf("expected %+v but got %+v", f, read)
+	}
+}
@@ -4,7 +4,6 @@
 package keyring
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/godbus/dbus/v5"
@@ -27,6 +26,9 @@ const (
 // Item implements a wrapper for org.freedesktop.Secret.Item as defined
 // here https://specifications.freedesktop.org/secret-service/re03.html
 type Item interface {
+	// Path returns the ObjectPath of the item
+	Path() dbus.ObjectPath
+
 	// Locked returns true if the item is currently locked
 	Locked() (bool, error)
 
@@ -52,7 +54,7 @@ type Item interface {
 	GetSecret(session dbus.ObjectPath) (*Secret, error)
 
 	// SetSecret sets the secret of the item
-	SetSecret(dbus.ObjectPath, []byte, string) error
+	SetSecret(dbus.ObjectPath, SecretValue, string) error
 
 	// GetCreated returns the time the item has been created
 	GetCreated() (time.Time, error)
@@ -63,6 +65,11 @@ type Item interface {
 
 // GetItem returns a new item client for the specified path
 func GetItem(conn *dbus.Conn, path dbus.ObjectPath) (Item, error) {
+	return newItem(conn, path)
+}
+
+// newItem returns a new item client for the specified path on conn
+func newItem(conn busConn, path dbus.ObjectPath) (Item, error) {
 	obj := conn.Object(SecretServiceDest, path)
 	i := &item{
 		path: path,
@@ -80,10 +87,15 @@ func GetItem(conn *dbus.Conn, path dbus.ObjectPath) (Item, error) {
 // item implements the Item interface
 type item struct {
 	path dbus.ObjectPath
-	conn *dbus.Conn
+	conn busConn
 	obj  dbus.BusObject
 }
 
+// Path returns the ObjectPath of the item
+func (i *item) Path() dbus.ObjectPath {
+	return i.path
+}
+
 // Locked returns true if the item is currently locked
 func (i *item) Locked() (bool, error) {
 	v, err := i.obj.GetProperty(itemPropLocked)
@@ -100,7 +112,7 @@ func (i *item) Locked() (bool, error) {
 
 // Unlock unlocks the item and handles any prompt that might be required
 func (i *item) Unlock() (bool, error) {
-	service, err := GetSecretService(i.conn)
+	service, err := newSecretService(i.conn)
 	if err != nil {
 		return false, err
 	}
@@ -128,7 +140,7 @@ func (i *item) GetAttributes() (map[string]string, error) {
 
 // SetAttributes sets the items attributes
 func (i *item) SetAttributes(m map[string]string) error {
-	return i.obj.SetProperty(itemPropAttributes, m)
+	return i.obj.SetProperty(itemPropAttributes, dbus.MakeVariant(m))
 }
 
 // GetLabel returns the label of the item
@@ -147,7 +159,7 @@ func (i *item) GetLabel() (string, error) {
 
 // SetLabel sets the item's label
 func (i *item) SetLabel(l string) error {
-	return i.obj.SetProperty(itemPropLabel, l)
+	return i.obj.SetProperty(itemPropLabel, dbus.MakeVariant(l))
 }
 
 // Delete deletes the item any handles any prompt that might be required
@@ -163,7 +175,7 @@ func (i *item) Delete() error {
 	}
 
 	if prompt != "/" {
-		p := GetPrompt(i.conn, prompt)
+		p := newPrompt(i.conn, prompt)
 		res, err := p.Prompt("")
 		if err != nil {
 			return err
@@ -171,7 +183,7 @@ func (i *item) Delete() error {
 
 		result := <-res
 		if result == nil {
-			return fmt.Errorf("prompt dismissed")
+			return ErrPromptDismissed
 		}
 	}
 
@@ -191,11 +203,13 @@ func (i *item) GetSecret(session dbus.ObjectPath) (*Secret, error) {
 		return nil, err
 	}
 
+	s.harden()
+
 	return &s, nil
 }
 
 // SetSecret sets the secret of the item
-func (i *item) SetSecret(session dbus.ObjectPath, secret []byte, contentType string) error {
+func (i *item) SetSecret(session dbus.ObjectPath, secret SecretValue, contentType string) error {
 	call := i.obj.Call(itemMethodSetSecret, 0, Secret{
 		ContentType: contentType,
 		Value:       secret,
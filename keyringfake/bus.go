@@ -0,0 +1,730 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyringfake
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+const (
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+
+	signalCollectionCreated = keyring.ServiceInterface + ".CollectionCreated"
+	signalCollectionDeleted = keyring.ServiceInterface + ".CollectionDeleted"
+	signalCollectionChanged = keyring.ServiceInterface + ".CollectionChanged"
+	signalItemCreated       = keyring.CollectionInterface + ".ItemCreated"
+	signalItemDeleted       = keyring.CollectionInterface + ".ItemDeleted"
+	signalItemChanged       = keyring.CollectionInterface + ".ItemChanged"
+	signalPromptCompleted   = keyring.PromptInterface + ".Completed"
+
+	errorNotSupported   = "org.freedesktop.DBus.Error.NotSupported"
+	errorUnknownProp    = "org.freedesktop.DBus.Error.UnknownProperty"
+	errorUnknownIface   = "org.freedesktop.DBus.Error.UnknownInterface"
+	errorInvalidArgs    = "org.freedesktop.DBus.Error.InvalidArgs"
+	errorPropertyAccess = "org.freedesktop.DBus.Error.PropertyReadOnly"
+
+	// noPrompt is returned instead of a prompt path if no prompt is required
+	noPrompt = dbus.ObjectPath("/")
+)
+
+// Serve exports s on conn and requests the name keyring.SecretServiceDest so
+// clients connected to the same message bus use s like a real provider.
+// Changes are announced using the signals of the Secret Service API, prompts
+// are decided by the PromptHandler once a client calls Prompt.Prompt
+func (s *Service) Serve(conn *dbus.Conn) error {
+	b := &busService{svc: s}
+
+	tables := map[string]map[string]interface{}{
+		keyring.ServiceInterface:    b.serviceMethods(),
+		keyring.CollectionInterface: b.collectionMethods(),
+		keyring.ItemInterface:       b.itemMethods(),
+		keyring.SessionInterface:    b.sessionMethods(),
+		keyring.PromptInterface:     b.promptMethods(),
+		propertiesInterface:         b.propertiesMethods(),
+		"org.freedesktop.DBus.Introspectable": {
+			"Introspect": b.introspect,
+		},
+	}
+
+	for iface, methods := range tables {
+		if err := conn.ExportSubtreeMethodTable(methods, keyring.SecretServicePath, iface); err != nil {
+			return err
+		}
+	}
+
+	s.l.Lock()
+	s.signals = newSignalQueue(conn)
+	s.l.Unlock()
+
+	reply, err := conn.RequestName(keyring.SecretServiceDest, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("%s is already owned by another connection", keyring.SecretServiceDest)
+	}
+
+	return nil
+}
+
+// signal queues the signal name for path if s is served on a bus. It must be
+// called with s.l held
+func (s *Service) signal(path dbus.ObjectPath, name string, values ...interface{}) {
+	if s.signals != nil {
+		s.signals.push(&dbus.Signal{
+			Path: path,
+			Name: name,
+			Body: values,
+		})
+	}
+}
+
+// resolve returns the path of the collection if path is an alias path. It
+// must be called with s.l held
+func (s *Service) resolve(path dbus.ObjectPath) dbus.ObjectPath {
+	if alias := strings.TrimPrefix(string(path), keyring.AliasesPath+"/"); alias != string(path) {
+		if target, ok := s.aliases[alias]; ok {
+			return target
+		}
+	}
+
+	return path
+}
+
+// signalQueue emits signals on a connection in the order they are queued
+// without blocking the caller
+type signalQueue struct {
+	conn *dbus.Conn
+	wake chan struct{}
+
+	l     sync.Mutex
+	queue []*dbus.Signal
+}
+
+// newSignalQueue returns a signalQueue that emits signals until conn is
+// closed
+func newSignalQueue(conn *dbus.Conn) *signalQueue {
+	q := &signalQueue{
+		conn: conn,
+		wake: make(chan struct{}, 1),
+	}
+
+	go q.run()
+
+	return q
+}
+
+// push queues sig
+func (q *signalQueue) push(sig *dbus.Signal) {
+	q.l.Lock()
+	q.queue = append(q.queue, sig)
+	q.l.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *signalQueue) run() {
+	for {
+		select {
+		case <-q.wake:
+		case <-q.conn.Context().Done():
+			return
+		}
+
+		q.l.Lock()
+		queue := q.queue
+		q.queue = nil
+		q.l.Unlock()
+
+		for _, sig := range queue {
+			_ = q.conn.Emit(sig.Path, sig.Name, sig.Body...)
+		}
+	}
+}
+
+// busService implements the method tables exported by Service.Serve. All
+// interfaces are exported for the whole subtree below
+// keyring.SecretServicePath, the methods check that the object a call is
+// addressed to implements the interface
+type busService struct {
+	svc *Service
+}
+
+// busError converts err into the error replied to the caller
+func busError(err error) *dbus.Error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case dbus.Error:
+		return &e
+	case *dbus.Error:
+		return e
+	}
+
+	return dbus.MakeFailedError(err)
+}
+
+// callPath returns the object path a call has been sent to
+func callPath(msg dbus.Message) dbus.ObjectPath {
+	p, _ := msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+	return p
+}
+
+// paths returns the object paths of items
+func paths(items []keyring.Item) []dbus.ObjectPath {
+	result := make([]dbus.ObjectPath, len(items))
+	for i, item := range items {
+		result[i] = item.Path()
+	}
+
+	return result
+}
+
+// service returns an error if msg is not addressed to the service object
+func (b *busService) service(msg dbus.Message) error {
+	if p := callPath(msg); p != keyring.SecretServicePath {
+		return errUnknownObject(p)
+	}
+
+	return nil
+}
+
+// collection returns the collection msg is addressed to
+func (b *busService) collection(msg dbus.Message) (*Collection, error) {
+	b.svc.l.Lock()
+	defer b.svc.l.Unlock()
+
+	p := b.svc.resolve(callPath(msg))
+	if b.svc.collection(p) == nil {
+		return nil, errUnknownObject(p)
+	}
+
+	return &Collection{svc: b.svc, path: p}, nil
+}
+
+// item returns the item msg is addressed to
+func (b *busService) item(msg dbus.Message) (*Item, error) {
+	b.svc.l.Lock()
+	defer b.svc.l.Unlock()
+
+	p := callPath(msg)
+	if _, ok := b.svc.items[p]; !ok {
+		return nil, errUnknownObject(p)
+	}
+
+	return &Item{svc: b.svc, path: p}, nil
+}
+
+// session returns the session msg is addressed to
+func (b *busService) session(msg dbus.Message) (*Session, error) {
+	b.svc.l.Lock()
+	defer b.svc.l.Unlock()
+
+	p := callPath(msg)
+	if !b.svc.sessions[p] {
+		return nil, errUnknownObject(p)
+	}
+
+	return &Session{svc: b.svc, path: p}, nil
+}
+
+// prompt returns the pending prompt msg is addressed to
+func (b *busService) prompt(msg dbus.Message) (*Prompt, error) {
+	b.svc.l.Lock()
+	defer b.svc.l.Unlock()
+
+	p := callPath(msg)
+	prompt, ok := b.svc.pending[p]
+	if !ok {
+		return nil, errUnknownObject(p)
+	}
+
+	return prompt, nil
+}
+
+func (b *busService) serviceMethods() map[string]interface{} {
+	svc := b.svc
+
+	return map[string]interface{}{
+		"OpenSession": func(msg dbus.Message, alg string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+			if err := b.service(msg); err != nil {
+				return dbus.MakeVariant(""), noPrompt, busError(err)
+			}
+
+			if alg != keyring.AlgPlain {
+				return dbus.MakeVariant(""), noPrompt, dbus.NewError(errorNotSupported, []interface{}{
+					fmt.Sprintf("algorithm %s is not supported", alg),
+				})
+			}
+
+			session, err := svc.OpenSession()
+			if err != nil {
+				return dbus.MakeVariant(""), noPrompt, busError(err)
+			}
+
+			return dbus.MakeVariant(""), session.Path(), nil
+		},
+		"CreateCollection": func(msg dbus.Message, props map[string]dbus.Variant, alias string) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+			if err := b.service(msg); err != nil {
+				return noPrompt, noPrompt, busError(err)
+			}
+
+			label, _ := props[keyring.CollectionInterface+".Label"].Value().(string)
+
+			svc.l.Lock()
+			p := svc.createCollection(label, alias)
+			svc.l.Unlock()
+
+			return noPrompt, p.Path(), nil
+		},
+		"SearchItems": func(msg dbus.Message, attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+			if err := b.service(msg); err != nil {
+				return nil, nil, busError(err)
+			}
+
+			unlocked, locked, err := svc.SearchItems(attrs)
+			if err != nil {
+				return nil, nil, busError(err)
+			}
+
+			return paths(unlocked), paths(locked), nil
+		},
+		"Unlock": func(msg dbus.Message, objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+			if err := b.service(msg); err != nil {
+				return nil, noPrompt, busError(err)
+			}
+
+			unlocked, p, err := svc.unlock(objects)
+			if err != nil {
+				return nil, noPrompt, busError(err)
+			}
+
+			if p == nil {
+				return unlocked, noPrompt, nil
+			}
+
+			return unlocked, p.Path(), nil
+		},
+		"Lock": func(msg dbus.Message, objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+			if err := b.service(msg); err != nil {
+				return nil, noPrompt, busError(err)
+			}
+
+			locked, err := svc.Lock(objects)
+			return locked, noPrompt, busError(err)
+		},
+		"GetSecrets": func(msg dbus.Message, items []dbus.ObjectPath, session dbus.ObjectPath) (map[dbus.ObjectPath]keyring.Secret, *dbus.Error) {
+			if err := b.service(msg); err != nil {
+				return nil, busError(err)
+			}
+
+			secrets, err := svc.GetSecrets(items, session)
+			if err != nil {
+				return nil, busError(err)
+			}
+
+			result := make(map[dbus.ObjectPath]keyring.Secret, len(secrets))
+			for p, s := range secrets {
+				result[p] = *s
+			}
+
+			return result, nil
+		},
+		"ReadAlias": func(msg dbus.Message, name string) (dbus.ObjectPath, *dbus.Error) {
+			if err := b.service(msg); err != nil {
+				return "/", busError(err)
+			}
+
+			p, err := svc.ReadAlias(name)
+			if err == keyring.ErrUnknownAlias {
+				return "/", nil
+			}
+
+			return p, busError(err)
+		},
+		"SetAlias": func(msg dbus.Message, name string, collection dbus.ObjectPath) *dbus.Error {
+			if err := b.service(msg); err != nil {
+				return busError(err)
+			}
+
+			return busError(svc.SetAlias(name, collection))
+		},
+	}
+}
+
+func (b *busService) collectionMethods() map[string]interface{} {
+	return map[string]interface{}{
+		"Delete": func(msg dbus.Message) (dbus.ObjectPath, *dbus.Error) {
+			c, err := b.collection(msg)
+			if err == nil {
+				err = c.Delete()
+			}
+
+			return noPrompt, busError(err)
+		},
+		"SearchItems": func(msg dbus.Message, attrs map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+			c, err := b.collection(msg)
+			if err != nil {
+				return nil, busError(err)
+			}
+
+			items, err := c.SearchItems(attrs)
+			if err != nil {
+				return nil, busError(err)
+			}
+
+			return paths(items), nil
+		},
+		"CreateItem": func(msg dbus.Message, props map[string]dbus.Variant, secret keyring.Secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+			c, err := b.collection(msg)
+			if err != nil {
+				return noPrompt, noPrompt, busError(err)
+			}
+
+			label, _ := props[keyring.ItemInterface+".Label"].Value().(string)
+			attrs, _ := props[keyring.ItemInterface+".Attributes"].Value().(map[string]string)
+
+			item, err := c.CreateItem(secret.Session, label, attrs, secret.Value, secret.ContentType, replace)
+			if err != nil {
+				return noPrompt, noPrompt, busError(err)
+			}
+
+			return item.Path(), noPrompt, nil
+		},
+	}
+}
+
+func (b *busService) itemMethods() map[string]interface{} {
+	return map[string]interface{}{
+		"Delete": func(msg dbus.Message) (dbus.ObjectPath, *dbus.Error) {
+			i, err := b.item(msg)
+			if err == nil {
+				err = i.Delete()
+			}
+
+			return noPrompt, busError(err)
+		},
+		"GetSecret": func(msg dbus.Message, session dbus.ObjectPath) (keyring.Secret, *dbus.Error) {
+			i, err := b.item(msg)
+			if err != nil {
+				return keyring.Secret{}, busError(err)
+			}
+
+			secret, err := i.GetSecret(session)
+			if err != nil {
+				return keyring.Secret{}, busError(err)
+			}
+
+			return *secret, nil
+		},
+		"SetSecret": func(msg dbus.Message, secret keyring.Secret) *dbus.Error {
+			i, err := b.item(msg)
+			if err == nil {
+				err = i.SetSecret(secret.Session, secret.Value, secret.ContentType)
+			}
+
+			return busError(err)
+		},
+	}
+}
+
+func (b *busService) sessionMethods() map[string]interface{} {
+	return map[string]interface{}{
+		"Close": func(msg dbus.Message) *dbus.Error {
+			s, err := b.session(msg)
+			if err == nil {
+				err = s.Close()
+			}
+
+			return busError(err)
+		},
+	}
+}
+
+func (b *busService) promptMethods() map[string]interface{} {
+	return map[string]interface{}{
+		"Prompt": func(msg dbus.Message, windowID string) *dbus.Error {
+			p, err := b.prompt(msg)
+			if err == nil {
+				_, err = p.Prompt(windowID)
+			}
+
+			return busError(err)
+		},
+		"Dismiss": func(msg dbus.Message) *dbus.Error {
+			p, err := b.prompt(msg)
+			if err == nil {
+				err = p.Dismiss()
+			}
+
+			return busError(err)
+		},
+	}
+}
+
+func (b *busService) propertiesMethods() map[string]interface{} {
+	return map[string]interface{}{
+		"Get": func(msg dbus.Message, iface, name string) (dbus.Variant, *dbus.Error) {
+			props, err := b.properties(msg, iface)
+			if err != nil {
+				return dbus.MakeVariant(""), busError(err)
+			}
+
+			v, ok := props[name]
+			if !ok {
+				return dbus.MakeVariant(""), dbus.NewError(errorUnknownProp, []interface{}{
+					fmt.Sprintf("no property %s.%s", iface, name),
+				})
+			}
+
+			return v, nil
+		},
+		"GetAll": func(msg dbus.Message, iface string) (map[string]dbus.Variant, *dbus.Error) {
+			props, err := b.properties(msg, iface)
+			return props, busError(err)
+		},
+		"Set": func(msg dbus.Message, iface, name string, value dbus.Variant) *dbus.Error {
+			// godbus accepts any value for a variant argument while
+			// providers reject everything but ssv
+			if sig := signature(msg); sig != "ssv" {
+				return dbus.NewError(errorInvalidArgs, []interface{}{
+					fmt.Sprintf("invalid signature %q for Set, expected \"ssv\"", sig),
+				})
+			}
+
+			return busError(b.setProperty(msg, iface, name, value))
+		},
+	}
+}
+
+// signature returns the signature of the body of msg
+func signature(msg dbus.Message) string {
+	if v, ok := msg.Headers[dbus.FieldSignature]; ok {
+		if sig, ok := v.Value().(dbus.Signature); ok {
+			return sig.String()
+		}
+	}
+
+	return ""
+}
+
+// properties returns the properties of iface of the object msg is addressed
+// to
+func (b *busService) properties(msg dbus.Message, iface string) (map[string]dbus.Variant, error) {
+	switch iface {
+	case keyring.ServiceInterface:
+		if err := b.service(msg); err != nil {
+			return nil, err
+		}
+
+		all, err := b.svc.GetAllCollections()
+		if err != nil {
+			return nil, err
+		}
+
+		collections := make([]dbus.ObjectPath, len(all))
+		for i, c := range all {
+			collections[i] = c.Path()
+		}
+
+		return map[string]dbus.Variant{
+			"Collections": dbus.MakeVariant(collections),
+		}, nil
+
+	case keyring.CollectionInterface:
+		c, err := b.collection(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		b.svc.l.Lock()
+		defer b.svc.l.Unlock()
+
+		col, err := c.state()
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]dbus.Variant{
+			"Items":    dbus.MakeVariant(append([]dbus.ObjectPath{}, col.items...)),
+			"Label":    dbus.MakeVariant(col.label),
+			"Locked":   dbus.MakeVariant(col.locked),
+			"Created":  dbus.MakeVariant(uint64(col.created.Unix())),
+			"Modified": dbus.MakeVariant(uint64(col.modified.Unix())),
+		}, nil
+
+	case keyring.ItemInterface:
+		i, err := b.item(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		b.svc.l.Lock()
+		defer b.svc.l.Unlock()
+
+		state, err := i.state()
+		if err != nil {
+			return nil, err
+		}
+
+		locked, _ := b.svc.isLocked(i.path)
+
+		return map[string]dbus.Variant{
+			"Locked":     dbus.MakeVariant(locked),
+			"Attributes": dbus.MakeVariant(copyAttributes(state.attrs)),
+			"Label":      dbus.MakeVariant(state.label),
+			"Created":    dbus.MakeVariant(uint64(state.created.Unix())),
+			"Modified":   dbus.MakeVariant(uint64(state.modified.Unix())),
+		}, nil
+
+	case keyring.SessionInterface:
+		_, err := b.session(msg)
+		return map[string]dbus.Variant{}, err
+
+	case keyring.PromptInterface:
+		_, err := b.prompt(msg)
+		return map[string]dbus.Variant{}, err
+	}
+
+	return nil, dbus.NewError(errorUnknownIface, []interface{}{
+		fmt.Sprintf("no interface %s", iface),
+	})
+}
+
+// setProperty sets the property name of iface of the object msg is
+// addressed to
+func (b *busService) setProperty(msg dbus.Message, iface, name string, value dbus.Variant) error {
+	if _, err := b.properties(msg, iface); err != nil {
+		return err
+	}
+
+	invalid := dbus.NewError(errorInvalidArgs, []interface{}{
+		fmt.Sprintf("invalid value for %s.%s", iface, name),
+	})
+
+	switch iface + "." + name {
+	case keyring.CollectionInterface + ".Label":
+		label, ok := value.Value().(string)
+		if !ok {
+			return invalid
+		}
+
+		c, err := b.collection(msg)
+		if err != nil {
+			return err
+		}
+
+		return c.SetLabel(label)
+
+	case keyring.ItemInterface + ".Label":
+		label, ok := value.Value().(string)
+		if !ok {
+			return invalid
+		}
+
+		i, err := b.item(msg)
+		if err != nil {
+			return err
+		}
+
+		return i.SetLabel(label)
+
+	case keyring.ItemInterface + ".Attributes":
+		attrs, ok := value.Value().(map[string]string)
+		if !ok {
+			return invalid
+		}
+
+		i, err := b.item(msg)
+		if err != nil {
+			return err
+		}
+
+		return i.SetAttributes(attrs)
+	}
+
+	return dbus.NewError(errorPropertyAccess, []interface{}{
+		fmt.Sprintf("property %s.%s cannot be set", iface, name),
+	})
+}
+
+// introspect describes the object msg is addressed to and lists its children
+func (b *busService) introspect(msg dbus.Message) (string, *dbus.Error) {
+	p := callPath(msg)
+
+	node := introspect.Node{
+		Name: string(p),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			{Name: propertiesInterface},
+		},
+	}
+
+	addChildren := func(prefix string, paths []dbus.ObjectPath) {
+		for _, child := range paths {
+			if strings.HasPrefix(string(child), prefix+"/") {
+				node.Children = append(node.Children, introspect.Node{
+					Name: path.Base(string(child)),
+				})
+			}
+		}
+	}
+
+	b.svc.l.Lock()
+
+	resolved := b.svc.resolve(p)
+
+	switch {
+	case p == keyring.SecretServicePath:
+		node.Interfaces = append(node.Interfaces, introspect.Interface{Name: keyring.ServiceInterface})
+		node.Children = []introspect.Node{{Name: "aliases"}, {Name: "collection"}}
+
+	case p == keyring.AliasesPath:
+		for name := range b.svc.aliases {
+			node.Children = append(node.Children, introspect.Node{Name: name})
+		}
+
+	case p == keyring.SecretServicePath+"/collection":
+		for _, c := range b.svc.collections {
+			addChildren(string(p), []dbus.ObjectPath{c.path})
+		}
+
+	case b.svc.collection(resolved) != nil:
+		node.Interfaces = append(node.Interfaces, introspect.Interface{Name: keyring.CollectionInterface})
+		addChildren(string(resolved), b.svc.collection(resolved).items)
+
+	case b.svc.items[p] != nil:
+		node.Interfaces = append(node.Interfaces, introspect.Interface{Name: keyring.ItemInterface})
+
+	case b.svc.sessions[p]:
+		node.Interfaces = append(node.Interfaces, introspect.Interface{Name: keyring.SessionInterface})
+
+	case b.svc.pending[p] != nil:
+		node.Interfaces = append(node.Interfaces, introspect.Interface{Name: keyring.PromptInterface})
+
+	default:
+		node.Interfaces = node.Interfaces[:1]
+	}
+
+	b.svc.l.Unlock()
+
+	data, err := xml.Marshal(node)
+	if err != nil {
+		return "", busError(err)
+	}
+
+	return string(data), nil
+}
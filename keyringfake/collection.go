@@ -0,0 +1,279 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyringfake
+
+import (
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+// Collection is an in-memory implementation of keyring.Collection
+type Collection struct {
+	svc  *Service
+	path dbus.ObjectPath
+}
+
+// state returns the state of the collection. It must be called with c.svc.l
+// held
+func (c *Collection) state() (*collectionState, error) {
+	col := c.svc.collection(c.path)
+	if col == nil {
+		return nil, errUnknownObject(c.path)
+	}
+
+	return col, nil
+}
+
+// Path returns the object path of the collection
+func (c *Collection) Path() dbus.ObjectPath {
+	return c.path
+}
+
+// GetLabel returns the label of the collection
+func (c *Collection) GetLabel() (string, error) {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return "", err
+	}
+
+	return col.label, nil
+}
+
+// SetLabel sets the label of the collection
+func (c *Collection) SetLabel(l string) error {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return err
+	}
+
+	col.label = l
+	col.modified = c.svc.now()
+	c.svc.signal(keyring.SecretServicePath, signalCollectionChanged, c.path)
+
+	return nil
+}
+
+// Locked returns true if the collection is locked
+func (c *Collection) Locked() (bool, error) {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return false, err
+	}
+
+	return col.locked, nil
+}
+
+// GetCreated returns the time the collection was created
+func (c *Collection) GetCreated() (time.Time, error) {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return col.created, nil
+}
+
+// GetModified returns the time the collection was last modified
+func (c *Collection) GetModified() (time.Time, error) {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return col.modified, nil
+}
+
+// Delete deletes the collection, its items and all aliases referencing it
+func (c *Collection) Delete() error {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range col.items {
+		delete(c.svc.items, p)
+	}
+
+	for name, target := range c.svc.aliases {
+		if target == c.path {
+			delete(c.svc.aliases, name)
+		}
+	}
+
+	for idx, other := range c.svc.collections {
+		if other == col {
+			c.svc.collections = append(c.svc.collections[:idx], c.svc.collections[idx+1:]...)
+			break
+		}
+	}
+	c.svc.signal(keyring.SecretServicePath, signalCollectionDeleted, c.path)
+
+	return nil
+}
+
+// GetAllItems returns all items of the collection in the order they were
+// created
+func (c *Collection) GetAllItems() ([]keyring.Item, error) {
+	return c.SearchItems(nil)
+}
+
+// GetItem returns the item with the given label
+func (c *Collection) GetItem(name string) (keyring.Item, error) {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range col.items {
+		if c.svc.items[p].label == name {
+			return &Item{svc: c.svc, path: p}, nil
+		}
+	}
+
+	return nil, keyring.ErrNoSuchItem
+}
+
+// SearchItems returns all items of the collection whose attributes include
+// attrs
+func (c *Collection) SearchItems(attrs map[string]string) ([]keyring.Item, error) {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return nil, err
+	}
+
+	items := []keyring.Item{}
+	for _, p := range col.items {
+		if matches(c.svc.items[p].attrs, attrs) {
+			items = append(items, &Item{svc: c.svc, path: p})
+		}
+	}
+
+	return items, nil
+}
+
+// Query returns all items of the collection that match q
+func (c *Collection) Query(q *keyring.Query) ([]keyring.Item, error) {
+	items, err := c.SearchItems(q.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Filter(items)
+}
+
+// CreateItem creates a new item. If replace is set, an existing item with
+// the same attributes is updated instead
+func (c *Collection) CreateItem(session dbus.ObjectPath, label string, attr map[string]string, secret keyring.SecretValue, contentType string, replace bool) (keyring.Item, error) {
+	c.svc.l.Lock()
+	defer c.svc.l.Unlock()
+
+	col, err := c.state()
+	if err != nil {
+		return nil, err
+	}
+
+	if col.locked {
+		return nil, errLocked(c.path)
+	}
+
+	if err := c.svc.checkSession(session); err != nil {
+		return nil, err
+	}
+
+	now := c.svc.now()
+
+	if replace {
+		for _, p := range col.items {
+			i := c.svc.items[p]
+			if len(i.attrs) == len(attr) && matches(i.attrs, attr) {
+				i.label = label
+				i.secret = append([]byte(nil), secret...)
+				i.contentType = contentType
+				i.modified = now
+				c.svc.signal(c.path, signalItemChanged, p)
+
+				return &Item{svc: c.svc, path: p}, nil
+			}
+		}
+	}
+
+	path := c.svc.newPath(string(c.path) + "/")
+	c.svc.items[path] = &itemState{
+		path:        path,
+		collection:  c.path,
+		label:       label,
+		attrs:       copyAttributes(attr),
+		secret:      append([]byte(nil), secret...),
+		contentType: contentType,
+		created:     now,
+		modified:    now,
+	}
+	col.items = append(col.items, path)
+	col.modified = now
+	c.svc.signal(c.path, signalItemCreated, path)
+
+	return &Item{svc: c.svc, path: path}, nil
+}
+
+// Upsert creates or updates the single item that matches attrs. If more than
+// one item matches attrs a *keyring.AmbiguousMatchError is returned
+func (c *Collection) Upsert(session dbus.ObjectPath, attrs map[string]string, label string, secret keyring.SecretValue, contentType string) (keyring.Item, error) {
+	items, err := c.SearchItems(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(items) {
+	case 0:
+		return c.CreateItem(session, label, attrs, secret, contentType, false)
+	case 1:
+	default:
+		return nil, &keyring.AmbiguousMatchError{
+			Attributes: attrs,
+			Matches:    len(items),
+		}
+	}
+
+	item := items[0]
+
+	if err := item.SetLabel(label); err != nil {
+		return nil, err
+	}
+
+	if err := item.SetAttributes(attrs); err != nil {
+		return nil, err
+	}
+
+	if err := item.SetSecret(session, secret, contentType); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyringfake
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Bus is a private message bus run by dbus-daemon. It allows to test clients
+// of a Service served on a bus without touching the session bus of the user
+type Bus struct {
+	// Address is the address clients connect to
+	Address string
+
+	cmd *exec.Cmd
+	dir string
+
+	l     sync.Mutex
+	conns []*dbus.Conn
+}
+
+// StartBus starts a private message bus. dbus-daemon must be installed
+func StartBus() (*Bus, error) {
+	dir, err := ioutil.TempDir("", "keyringfake")
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("dbus-daemon",
+		"--session",
+		"--nofork",
+		"--nopidfile",
+		"--print-address",
+		"--address=unix:path="+filepath.Join(dir, "bus"),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	b := &Bus{
+		cmd: cmd,
+		dir: dir,
+	}
+
+	// the address is printed once the bus accepts connections
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if b.Address = strings.TrimSpace(line); b.Address == "" {
+		b.Close()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New("dbus-daemon: " + msg)
+		}
+		if err == nil {
+			err = errors.New("dbus-daemon did not print its address")
+		}
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Serve connects to the bus and serves s on the new connection (see
+// Service.Serve). The connection is closed by Close
+func (b *Bus) Serve(s *Service) error {
+	conn, err := dbus.Dial(b.Address)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := s.Serve(conn); err != nil {
+		conn.Close()
+		return err
+	}
+
+	b.l.Lock()
+	b.conns = append(b.conns, conn)
+	b.l.Unlock()
+
+	return nil
+}
+
+// Close closes the connections opened by Serve and stops the bus
+func (b *Bus) Close() error {
+	b.l.Lock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+	b.l.Unlock()
+
+	_ = b.cmd.Process.Kill()
+	_ = b.cmd.Wait()
+
+	return os.RemoveAll(b.dir)
+}
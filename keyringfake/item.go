@@ -0,0 +1,228 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyringfake
+
+import (
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+// Item is an in-memory implementation of keyring.Item. Items are locked
+// together with their collection
+type Item struct {
+	svc  *Service
+	path dbus.ObjectPath
+}
+
+// state returns the state of the item. It must be called with i.svc.l held
+func (i *Item) state() (*itemState, error) {
+	state, ok := i.svc.items[i.path]
+	if !ok {
+		return nil, errUnknownObject(i.path)
+	}
+
+	return state, nil
+}
+
+// writable returns the state of the item if it is unlocked. It must be
+// called with i.svc.l held
+func (i *Item) writable() (*itemState, error) {
+	state, err := i.state()
+	if err != nil {
+		return nil, err
+	}
+
+	if locked, _ := i.svc.isLocked(i.path); locked {
+		return nil, errLocked(i.path)
+	}
+
+	return state, nil
+}
+
+// toSecret returns the secret of i for session
+func (i *itemState) toSecret(session dbus.ObjectPath) *keyring.Secret {
+	return &keyring.Secret{
+		Session:     session,
+		Parameters:  []byte{},
+		Value:       append(keyring.SecretValue(nil), i.secret...),
+		ContentType: i.contentType,
+	}
+}
+
+// Path returns the object path of the item
+func (i *Item) Path() dbus.ObjectPath {
+	return i.path
+}
+
+// Locked returns true if the collection of the item is locked
+func (i *Item) Locked() (bool, error) {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	return i.svc.isLocked(i.path)
+}
+
+// Unlock unlocks the item and its collection after a prompt
+func (i *Item) Unlock() (bool, error) {
+	if _, err := i.svc.Unlock([]dbus.ObjectPath{i.path}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetAttributes returns the attributes of the item
+func (i *Item) GetAttributes() (map[string]string, error) {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.state()
+	if err != nil {
+		return nil, err
+	}
+
+	return copyAttributes(state.attrs), nil
+}
+
+// SetAttributes sets the attributes of the item
+func (i *Item) SetAttributes(attrs map[string]string) error {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.writable()
+	if err != nil {
+		return err
+	}
+
+	state.attrs = copyAttributes(attrs)
+	state.modified = i.svc.now()
+	i.svc.signal(state.collection, signalItemChanged, i.path)
+
+	return nil
+}
+
+// GetLabel returns the label of the item
+func (i *Item) GetLabel() (string, error) {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.state()
+	if err != nil {
+		return "", err
+	}
+
+	return state.label, nil
+}
+
+// SetLabel sets the label of the item
+func (i *Item) SetLabel(label string) error {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.writable()
+	if err != nil {
+		return err
+	}
+
+	state.label = label
+	state.modified = i.svc.now()
+	i.svc.signal(state.collection, signalItemChanged, i.path)
+
+	return nil
+}
+
+// Delete deletes the item
+func (i *Item) Delete() error {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.state()
+	if err != nil {
+		return err
+	}
+
+	delete(i.svc.items, i.path)
+
+	if col := i.svc.collection(state.collection); col != nil {
+		for idx, p := range col.items {
+			if p == i.path {
+				col.items = append(col.items[:idx], col.items[idx+1:]...)
+				break
+			}
+		}
+		col.modified = i.svc.now()
+	}
+	i.svc.signal(state.collection, signalItemDeleted, i.path)
+
+	return nil
+}
+
+// GetSecret returns the secret of the item. The item must be unlocked and
+// session must be open
+func (i *Item) GetSecret(session dbus.ObjectPath) (*keyring.Secret, error) {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.writable()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.svc.checkSession(session); err != nil {
+		return nil, err
+	}
+
+	return state.toSecret(session), nil
+}
+
+// SetSecret sets the secret of the item. The item must be unlocked and
+// session must be open
+func (i *Item) SetSecret(session dbus.ObjectPath, secret keyring.SecretValue, contentType string) error {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.writable()
+	if err != nil {
+		return err
+	}
+
+	if err := i.svc.checkSession(session); err != nil {
+		return err
+	}
+
+	state.secret = append([]byte(nil), secret...)
+	state.contentType = contentType
+	state.modified = i.svc.now()
+	i.svc.signal(state.collection, signalItemChanged, i.path)
+
+	return nil
+}
+
+// GetCreated returns the time the item was created
+func (i *Item) GetCreated() (time.Time, error) {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.state()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return state.created, nil
+}
+
+// GetModified returns the time the item was last modified
+func (i *Item) GetModified() (time.Time, error) {
+	i.svc.l.Lock()
+	defer i.svc.l.Unlock()
+
+	state, err := i.state()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return state.modified, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyringfake
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Prompt is an in-memory implementation of keyring.Prompt. The PromptHandler
+// of the service decides whether the prompt is accepted
+type Prompt struct {
+	svc    *Service
+	path   dbus.ObjectPath
+	paths  []dbus.ObjectPath
+	action func() dbus.Variant
+
+	l    sync.Mutex
+	done bool
+}
+
+// Path returns the object path of the prompt
+func (p *Prompt) Path() dbus.ObjectPath {
+	return p.path
+}
+
+// Prompt performs the prompt. The returned channel receives the result of
+// the prompt or nil if it has been dismissed
+func (p *Prompt) Prompt(windowID string) (<-chan *dbus.Variant, error) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if p.done {
+		return nil, errUnknownObject(p.path)
+	}
+	p.done = true
+
+	p.svc.l.Lock()
+	p.svc.prompts++
+	handler := p.svc.promptHandler
+	p.svc.l.Unlock()
+
+	ch := make(chan *dbus.Variant, 1)
+
+	if handler != nil && !handler(p.path, p.paths) {
+		p.complete(true, dbus.MakeVariant(""))
+		ch <- nil
+		return ch, nil
+	}
+
+	result := p.action()
+	p.complete(false, result)
+	ch <- &result
+
+	return ch, nil
+}
+
+// Dismiss dismisses the prompt. It is no longer valid afterwards
+func (p *Prompt) Dismiss() error {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if p.done {
+		return errUnknownObject(p.path)
+	}
+	p.done = true
+
+	p.complete(true, dbus.MakeVariant(""))
+
+	return nil
+}
+
+// complete removes the prompt from the pending prompts and emits the
+// Completed signal
+func (p *Prompt) complete(dismissed bool, result dbus.Variant) {
+	p.svc.l.Lock()
+	defer p.svc.l.Unlock()
+
+	delete(p.svc.pending, p.path)
+	p.svc.signal(p.path, signalPromptCompleted, dismissed, result)
+}
+
+// wait performs the prompt and returns its result or nil if it has been
+// dismissed
+func (p *Prompt) wait() (*dbus.Variant, error) {
+	res, err := p.Prompt("")
+	if err != nil {
+		return nil, err
+	}
+
+	return <-res, nil
+}
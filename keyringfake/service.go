@@ -0,0 +1,718 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+// Package keyringfake provides an in-memory implementation of the interfaces
+// of package keyring for tests that must not depend on DBus or a running
+// secret service provider.
+//
+// The fake follows the Secret Service API for locking, prompts, searching
+// and aliases: secrets of locked items cannot be read or written, unlocking
+// and creating collections require a prompt, secrets are only transferred
+// using open sessions and aliases are resolved like by a real provider.
+//
+// Service.Serve exports the fake on a message bus so it can also be used by
+// clients that talk DBus, like the ones returned by keyring.Connect.
+package keyringfake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+)
+
+const (
+	collectionPrefix = keyring.SecretServicePath + "/collection/"
+	sessionPrefix    = keyring.SecretServicePath + "/session/"
+	promptPrefix     = keyring.SecretServicePath + "/prompt/"
+
+	errorUnknownObject = "org.freedesktop.DBus.Error.UnknownObject"
+)
+
+// PromptHandler decides whether a prompt is accepted. It is called with the
+// path of the prompt and the paths of the objects the prompt is for. Returning
+// false dismisses the prompt
+type PromptHandler func(prompt dbus.ObjectPath, objects []dbus.ObjectPath) bool
+
+// Service is an in-memory implementation of keyring.SecretService
+type Service struct {
+	l sync.Mutex
+
+	collections []*collectionState
+	items       map[dbus.ObjectPath]*itemState
+	aliases     map[string]dbus.ObjectPath
+	sessions    map[dbus.ObjectPath]bool
+	pending     map[dbus.ObjectPath]*Prompt
+	nextID      int
+	prompts     int
+	signals     *signalQueue
+
+	promptHandler PromptHandler
+	caps          keyring.Capabilities
+	now           func() time.Time
+}
+
+// collectionState holds the state of a collection
+type collectionState struct {
+	path     dbus.ObjectPath
+	label    string
+	locked   bool
+	created  time.Time
+	modified time.Time
+	items    []dbus.ObjectPath
+}
+
+// itemState holds the state of an item
+type itemState struct {
+	path        dbus.ObjectPath
+	collection  dbus.ObjectPath
+	label       string
+	attrs       map[string]string
+	secret      []byte
+	contentType string
+	created     time.Time
+	modified    time.Time
+}
+
+// New returns an empty Service with an unlocked collection labeled
+// keyring.DefaultCollectionLabel that is assigned the default alias. All
+// prompts are accepted
+func New() *Service {
+	s := &Service{
+		items:    make(map[dbus.ObjectPath]*itemState),
+		aliases:  make(map[string]dbus.ObjectPath),
+		sessions: make(map[dbus.ObjectPath]bool),
+		pending:  make(map[dbus.ObjectPath]*Prompt),
+		now:      time.Now,
+		caps: keyring.Capabilities{
+			Provider:   keyring.Provider("keyringfake"),
+			Algorithms: []string{keyring.AlgPlain},
+			Aliases:    true,
+		},
+	}
+
+	col := s.addCollection(keyring.DefaultCollectionLabel)
+	s.aliases[keyring.DefaultAlias] = col.path
+
+	return s
+}
+
+// SetPromptHandler sets the handler that decides whether prompts are
+// accepted. A nil handler accepts all prompts
+func (s *Service) SetPromptHandler(h PromptHandler) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.promptHandler = h
+}
+
+// SetCapabilities sets the capabilities returned by Capabilities
+func (s *Service) SetCapabilities(caps keyring.Capabilities) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.caps = caps
+}
+
+// SetClock sets the function used to get the created and modified time
+func (s *Service) SetClock(now func() time.Time) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.now = now
+}
+
+// PromptCount returns the number of prompts performed so far
+func (s *Service) PromptCount() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return s.prompts
+}
+
+// newPath returns a new unique object path with prefix. It must be called
+// with s.l held
+func (s *Service) newPath(prefix string) dbus.ObjectPath {
+	s.nextID++
+	return dbus.ObjectPath(fmt.Sprintf("%s%d", prefix, s.nextID))
+}
+
+// addCollection adds a new unlocked collection. It must be called with s.l
+// held
+func (s *Service) addCollection(label string) *collectionState {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(label))
+
+	if name == "" {
+		name = "collection"
+	}
+
+	path := dbus.ObjectPath(collectionPrefix + name)
+	for n := 1; s.collection(path) != nil; n++ {
+		path = dbus.ObjectPath(fmt.Sprintf("%s%s_%d", collectionPrefix, name, n))
+	}
+
+	now := s.now()
+	col := &collectionState{
+		path:     path,
+		label:    label,
+		created:  now,
+		modified: now,
+	}
+	s.collections = append(s.collections, col)
+	s.signal(keyring.SecretServicePath, signalCollectionCreated, path)
+
+	return col
+}
+
+// collection returns the collection at path or nil. It must be called with
+// s.l held
+func (s *Service) collection(path dbus.ObjectPath) *collectionState {
+	for _, c := range s.collections {
+		if c.path == path {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// isLocked returns true if the collection or item at path is locked. It must
+// be called with s.l held
+func (s *Service) isLocked(path dbus.ObjectPath) (bool, error) {
+	if i, ok := s.items[path]; ok {
+		path = i.collection
+	}
+
+	col := s.collection(path)
+	if col == nil {
+		return false, errUnknownObject(path)
+	}
+
+	return col.locked, nil
+}
+
+// checkSession returns an error if session is not open. It must be called
+// with s.l held
+func (s *Service) checkSession(session dbus.ObjectPath) error {
+	if !s.sessions[session] {
+		return dbus.Error{
+			Name: keyring.ErrorNoSession,
+			Body: []interface{}{fmt.Sprintf("the session %s does not exist", session)},
+		}
+	}
+
+	return nil
+}
+
+// newPrompt returns a prompt for objects that calls action once it has been
+// accepted. It must be called with s.l held
+func (s *Service) newPrompt(objects []dbus.ObjectPath, action func() dbus.Variant) *Prompt {
+	p := &Prompt{
+		svc:    s,
+		path:   s.newPath(promptPrefix),
+		paths:  objects,
+		action: action,
+	}
+	s.pending[p.path] = p
+
+	return p
+}
+
+// errUnknownObject returns the error of calling an object that does not exist
+func errUnknownObject(path dbus.ObjectPath) error {
+	return dbus.Error{
+		Name: errorUnknownObject,
+		Body: []interface{}{fmt.Sprintf("no such object %s", path)},
+	}
+}
+
+// errLocked returns the error of accessing the secret of a locked object
+func errLocked(path dbus.ObjectPath) error {
+	return dbus.Error{
+		Name: keyring.ErrorIsLocked,
+		Body: []interface{}{fmt.Sprintf("the object %s is locked", path)},
+	}
+}
+
+// OpenSession opens a new session
+func (s *Service) OpenSession() (keyring.Session, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	path := s.newPath(sessionPrefix)
+	s.sessions[path] = true
+
+	return &Session{svc: s, path: path}, nil
+}
+
+// GetCollection returns the collection with the given label
+func (s *Service) GetCollection(name string) (keyring.Collection, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	for _, c := range s.collections {
+		if c.label == name {
+			return &Collection{svc: s, path: c.path}, nil
+		}
+	}
+
+	return nil, keyring.ErrUnknownCollection
+}
+
+// GetCollectionByPath returns the collection with the given object path
+func (s *Service) GetCollectionByPath(path dbus.ObjectPath) (keyring.Collection, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	path = s.resolve(path)
+	if s.collection(path) == nil {
+		return nil, errUnknownObject(path)
+	}
+
+	return &Collection{svc: s, path: path}, nil
+}
+
+// GetItemByPath returns the item with the given object path
+func (s *Service) GetItemByPath(path dbus.ObjectPath) (keyring.Item, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if _, ok := s.items[path]; !ok {
+		return nil, errUnknownObject(path)
+	}
+
+	return &Item{svc: s, path: path}, nil
+}
+
+// GetAllCollections returns all collections in the order they were created
+func (s *Service) GetAllCollections() ([]keyring.Collection, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	all := make([]keyring.Collection, len(s.collections))
+	for i, c := range s.collections {
+		all[i] = &Collection{svc: s, path: c.path}
+	}
+
+	return all, nil
+}
+
+// GetDefaultCollection returns the collection assigned the default alias
+func (s *Service) GetDefaultCollection() (keyring.Collection, error) {
+	return s.GetCollectionByPath(keyring.DefaultCollection)
+}
+
+// SearchItems returns all items whose attributes include attrs
+func (s *Service) SearchItems(attrs map[string]string) ([]keyring.Item, []keyring.Item, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	var unlocked, locked []keyring.Item
+	for _, c := range s.collections {
+		for _, p := range c.items {
+			if !matches(s.items[p].attrs, attrs) {
+				continue
+			}
+
+			if c.locked {
+				locked = append(locked, &Item{svc: s, path: p})
+			} else {
+				unlocked = append(unlocked, &Item{svc: s, path: p})
+			}
+		}
+	}
+
+	return unlocked, locked, nil
+}
+
+// matches returns true if attrs includes all of search
+func matches(attrs, search map[string]string) bool {
+	for k, v := range search {
+		if a, ok := attrs[k]; !ok || a != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Query returns all items that match q
+func (s *Service) Query(q *keyring.Query) ([]keyring.Item, error) {
+	unlocked, locked, err := s.SearchItems(q.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Filter(append(unlocked, locked...))
+}
+
+// GetSecrets returns the secrets of all unlocked items in paths
+func (s *Service) GetSecrets(paths []dbus.ObjectPath, session dbus.ObjectPath) (map[dbus.ObjectPath]*keyring.Secret, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if err := s.checkSession(session); err != nil {
+		return nil, err
+	}
+
+	secrets := make(map[dbus.ObjectPath]*keyring.Secret)
+	for _, p := range paths {
+		i, ok := s.items[p]
+		if !ok {
+			continue
+		}
+
+		if locked, _ := s.isLocked(p); locked {
+			continue
+		}
+
+		secrets[p] = i.toSecret(session)
+	}
+
+	return secrets, nil
+}
+
+// SearchAndRetrieve searches all collections for items matching attrs,
+// optionally unlocks them and fetches their secrets
+func (s *Service) SearchAndRetrieve(ctx context.Context, attrs map[string]string, opts keyring.RetrieveOptions) ([]*keyring.SearchResult, error) {
+	unlocked, locked, err := s.SearchItems(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Unlock && len(locked) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		paths := make([]dbus.ObjectPath, len(locked))
+		for i, item := range locked {
+			paths[i] = item.Path()
+		}
+
+		if _, err := s.Unlock(paths); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var secrets map[dbus.ObjectPath]*keyring.Secret
+	if !opts.SkipSecrets {
+		session := opts.Session
+		if session == nil {
+			if session, err = s.OpenSession(); err != nil {
+				return nil, err
+			}
+			defer session.Close()
+		}
+
+		paths := make([]dbus.ObjectPath, 0, len(unlocked)+len(locked))
+		for _, item := range append(unlocked, locked...) {
+			paths = append(paths, item.Path())
+		}
+
+		if secrets, err = s.GetSecrets(paths, session.Path()); err != nil {
+			return nil, err
+		}
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	var results []*keyring.SearchResult
+	for _, item := range append(unlocked, locked...) {
+		state := s.items[item.Path()]
+		col := s.collection(state.collection)
+
+		results = append(results, &keyring.SearchResult{
+			Item:            item,
+			Path:            state.path,
+			Collection:      col.path,
+			CollectionLabel: col.label,
+			Label:           state.label,
+			Attributes:      copyAttributes(state.attrs),
+			Locked:          col.locked,
+			Secret:          secrets[state.path],
+		})
+	}
+
+	defaultPath := s.aliases[keyring.DefaultAlias]
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+
+		if a.Collection != b.Collection {
+			if a.Collection == defaultPath {
+				return true
+			}
+			if b.Collection == defaultPath {
+				return false
+			}
+			return a.Collection < b.Collection
+		}
+
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+
+		return a.Path < b.Path
+	})
+
+	return results, nil
+}
+
+// ReadAlias returns the path of the collection assigned the alias name
+func (s *Service) ReadAlias(name string) (dbus.ObjectPath, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	path, ok := s.aliases[name]
+	if !ok {
+		return "/", keyring.ErrUnknownAlias
+	}
+
+	return path, nil
+}
+
+// SetAlias assigns the alias name to the collection at path. If path is "/"
+// the alias is removed
+func (s *Service) SetAlias(name string, path dbus.ObjectPath) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if path == "/" {
+		delete(s.aliases, name)
+		return nil
+	}
+
+	if s.collection(path) == nil {
+		return dbus.Error{
+			Name: keyring.ErrorNoSuchObject,
+			Body: []interface{}{fmt.Sprintf("no such collection %s", path)},
+		}
+	}
+
+	s.aliases[name] = path
+	return nil
+}
+
+// RemoveAlias removes the alias name
+func (s *Service) RemoveAlias(name string) error {
+	return s.SetAlias(name, "/")
+}
+
+// ListAliases returns all aliases and the paths of their collections
+func (s *Service) ListAliases() (map[string]dbus.ObjectPath, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	aliases := make(map[string]dbus.ObjectPath, len(s.aliases))
+	for k, v := range s.aliases {
+		aliases[k] = v
+	}
+
+	return aliases, nil
+}
+
+// GetCollectionByAlias returns the collection assigned the alias name
+func (s *Service) GetCollectionByAlias(name string) (keyring.Collection, error) {
+	path, err := s.ReadAlias(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCollectionByPath(path)
+}
+
+// EnsureDefaultCollection returns the default collection. If the default
+// alias is not set it is assigned to the collection labeled
+// keyring.DefaultCollectionLabel which is created if required
+func (s *Service) EnsureDefaultCollection() (keyring.Collection, error) {
+	col, err := s.GetCollectionByAlias(keyring.DefaultAlias)
+	if err != keyring.ErrUnknownAlias {
+		return col, err
+	}
+
+	if col, err := s.GetCollection(keyring.DefaultCollectionLabel); err == nil {
+		if err := s.SetAlias(keyring.DefaultAlias, col.Path()); err != nil {
+			return nil, err
+		}
+		return col, nil
+	}
+
+	return s.CreateCollection(keyring.DefaultCollectionLabel, keyring.DefaultAlias)
+}
+
+// CreateCollection creates a new collection after a prompt and optionally
+// assigns it alias
+func (s *Service) CreateCollection(label string, alias string) (keyring.Collection, error) {
+	s.l.Lock()
+	p := s.createCollection(label, alias)
+	s.l.Unlock()
+
+	result, err := p.wait()
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, keyring.ErrPromptDismissed
+	}
+
+	return &Collection{svc: s, path: result.Value().(dbus.ObjectPath)}, nil
+}
+
+// createCollection returns the prompt that creates a collection. It must be
+// called with s.l held
+func (s *Service) createCollection(label string, alias string) *Prompt {
+	return s.newPrompt(nil, func() dbus.Variant {
+		s.l.Lock()
+		defer s.l.Unlock()
+
+		col := s.addCollection(label)
+		if alias != "" {
+			s.aliases[alias] = col.path
+		}
+
+		return dbus.MakeVariant(col.path)
+	})
+}
+
+// Lock locks the collections and items at paths. Locking an item locks its
+// collection
+func (s *Service) Lock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	for _, p := range paths {
+		if _, err := s.isLocked(p); err != nil {
+			return nil, dbus.Error{
+				Name: keyring.ErrorNoSuchObject,
+				Body: []interface{}{fmt.Sprintf("no such object %s", p)},
+			}
+		}
+	}
+
+	for _, p := range paths {
+		s.setLocked(p, true)
+	}
+
+	return paths, nil
+}
+
+// Unlock unlocks the collections and items at paths. Unlocking a locked
+// object requires a prompt. Unlocking an item unlocks its collection
+func (s *Service) Unlock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	unlocked, p, err := s.unlock(paths)
+	if err != nil || p == nil {
+		return unlocked, err
+	}
+
+	result, err := p.wait()
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return unlocked, keyring.ErrPromptDismissed
+	}
+
+	return append(unlocked, result.Value().([]dbus.ObjectPath)...), nil
+}
+
+// unlock returns the objects in paths that are not locked and, if some
+// are, the prompt that unlocks them
+func (s *Service) unlock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, *Prompt, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	var unlocked, locked []dbus.ObjectPath
+	for _, p := range paths {
+		isLocked, err := s.isLocked(p)
+		if err != nil {
+			return nil, nil, dbus.Error{
+				Name: keyring.ErrorNoSuchObject,
+				Body: []interface{}{fmt.Sprintf("no such object %s", p)},
+			}
+		}
+
+		if isLocked {
+			locked = append(locked, p)
+		} else {
+			unlocked = append(unlocked, p)
+		}
+	}
+
+	if len(locked) == 0 {
+		return unlocked, nil, nil
+	}
+
+	p := s.newPrompt(locked, func() dbus.Variant {
+		s.l.Lock()
+		defer s.l.Unlock()
+
+		for _, p := range locked {
+			s.setLocked(p, false)
+		}
+
+		return dbus.MakeVariant(locked)
+	})
+
+	return unlocked, p, nil
+}
+
+// setLocked sets the lock state of the collection at path or of the
+// collection of the item at path. It must be called with s.l held
+func (s *Service) setLocked(path dbus.ObjectPath, locked bool) {
+	if i, ok := s.items[path]; ok {
+		path = i.collection
+	}
+
+	if col := s.collection(path); col != nil && col.locked != locked {
+		col.locked = locked
+		s.signal(keyring.SecretServicePath, signalCollectionChanged, col.path)
+	}
+}
+
+// Capabilities returns the capabilities set using SetCapabilities
+func (s *Service) Capabilities() (*keyring.Capabilities, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	caps := s.caps
+	caps.Algorithms = append([]string(nil), s.caps.Algorithms...)
+
+	return &caps, nil
+}
+
+// copyAttributes returns a copy of attrs
+func copyAttributes(attrs map[string]string) map[string]string {
+	c := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		c[k] = v
+	}
+
+	return c
+}
+
+// compile time checks
+var (
+	_ keyring.SecretService = (*Service)(nil)
+	_ keyring.Collection    = (*Collection)(nil)
+	_ keyring.Item          = (*Item)(nil)
+	_ keyring.Session       = (*Session)(nil)
+	_ keyring.Prompt        = (*Prompt)(nil)
+)
@@ -0,0 +1,275 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyringfake_test
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+// fixture is the state each spec check starts with: the default collection
+// holding a single item and an open session
+type fixture struct {
+	svc        *keyringfake.Service
+	collection keyring.Collection
+	item       keyring.Item
+	session    dbus.ObjectPath
+}
+
+func newFixture(t *testing.T) *fixture {
+	svc := keyringfake.New()
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := svc.GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := col.CreateItem(session.Path(), "db", map[string]string{"service": "db"}, keyring.SecretValue("hunter2"), "text/plain", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fixture{
+		svc:        svc,
+		collection: col,
+		item:       item,
+		session:    session.Path(),
+	}
+}
+
+// lock locks the default collection
+func (f *fixture) lock(t *testing.T) {
+	if _, err := f.svc.Lock([]dbus.ObjectPath{f.collection.Path()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// errorName returns the name of err if it is a dbus.Error
+func errorName(err error) string {
+	if e, ok := err.(dbus.Error); ok {
+		return e.Name
+	}
+
+	return ""
+}
+
+func TestServiceSpec(t *testing.T) {
+	cases := []struct {
+		name  string
+		check func(t *testing.T, f *fixture)
+	}{
+		{
+			name: "secrets of locked items cannot be read",
+			check: func(t *testing.T, f *fixture) {
+				f.lock(t)
+
+				if _, err := f.item.GetSecret(f.session); !keyring.IsLocked(err) {
+					t.Errorf("expected IsLocked but got %v", err)
+				}
+			},
+		},
+		{
+			name: "secrets of locked items cannot be written",
+			check: func(t *testing.T, f *fixture) {
+				f.lock(t)
+
+				if err := f.item.SetSecret(f.session, keyring.SecretValue("x"), "text/plain"); !keyring.IsLocked(err) {
+					t.Errorf("expected IsLocked but got %v", err)
+				}
+			},
+		},
+		{
+			name: "items cannot be created in locked collections",
+			check: func(t *testing.T, f *fixture) {
+				f.lock(t)
+
+				_, err := f.collection.CreateItem(f.session, "api", map[string]string{"service": "api"}, keyring.SecretValue("x"), "text/plain", false)
+				if !keyring.IsLocked(err) {
+					t.Errorf("expected IsLocked but got %v", err)
+				}
+			},
+		},
+		{
+			name: "secrets require an open session",
+			check: func(t *testing.T, f *fixture) {
+				if _, err := f.item.GetSecret("/org/freedesktop/secrets/session/unknown"); errorName(err) != keyring.ErrorNoSession {
+					t.Errorf("expected %s but got %v", keyring.ErrorNoSession, err)
+				}
+			},
+		},
+		{
+			name: "unlocking requires a prompt",
+			check: func(t *testing.T, f *fixture) {
+				f.lock(t)
+				before := f.svc.PromptCount()
+
+				unlocked, err := f.svc.Unlock([]dbus.ObjectPath{f.collection.Path()})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(unlocked) != 1 || unlocked[0] != f.collection.Path() {
+					t.Errorf("expected %s to be unlocked but got %v", f.collection.Path(), unlocked)
+				}
+
+				if f.svc.PromptCount() != before+1 {
+					t.Errorf("expected a prompt")
+				}
+
+				if _, err := f.item.GetSecret(f.session); err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			},
+		},
+		{
+			name: "unlocked objects do not require a prompt",
+			check: func(t *testing.T, f *fixture) {
+				unlocked, err := f.svc.Unlock([]dbus.ObjectPath{f.item.Path()})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(unlocked) != 1 || f.svc.PromptCount() != 0 {
+					t.Errorf("expected %s to be unlocked without a prompt", f.item.Path())
+				}
+			},
+		},
+		{
+			name: "dismissed unlock prompts keep objects locked",
+			check: func(t *testing.T, f *fixture) {
+				f.lock(t)
+				f.svc.SetPromptHandler(func(dbus.ObjectPath, []dbus.ObjectPath) bool { return false })
+
+				if _, err := f.svc.Unlock([]dbus.ObjectPath{f.collection.Path()}); err != keyring.ErrPromptDismissed {
+					t.Errorf("expected ErrPromptDismissed but got %v", err)
+				}
+
+				if locked, _ := f.collection.Locked(); !locked {
+					t.Errorf("expected the collection to be locked")
+				}
+			},
+		},
+		{
+			name: "dismissed create prompts do not create collections",
+			check: func(t *testing.T, f *fixture) {
+				f.svc.SetPromptHandler(func(dbus.ObjectPath, []dbus.ObjectPath) bool { return false })
+
+				if _, err := f.svc.CreateCollection("work", ""); err != keyring.ErrPromptDismissed {
+					t.Errorf("expected ErrPromptDismissed but got %v", err)
+				}
+
+				if _, err := f.svc.GetCollection("work"); err != keyring.ErrUnknownCollection {
+					t.Errorf("expected ErrUnknownCollection but got %v", err)
+				}
+			},
+		},
+		{
+			name: "search splits locked and unlocked items",
+			check: func(t *testing.T, f *fixture) {
+				col, err := f.svc.CreateCollection("work", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := col.CreateItem(f.session, "db", map[string]string{"service": "db", "env": "prod"}, keyring.SecretValue("x"), "text/plain", false); err != nil {
+					t.Fatal(err)
+				}
+				f.lock(t)
+
+				unlocked, locked, err := f.svc.SearchItems(map[string]string{"service": "db"})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(unlocked) != 1 || len(locked) != 1 || locked[0].Path() != f.item.Path() {
+					t.Errorf("expected one unlocked item and %s locked but got %d and %d", f.item.Path(), len(unlocked), len(locked))
+				}
+			},
+		},
+		{
+			name: "GetSecrets skips locked items",
+			check: func(t *testing.T, f *fixture) {
+				f.lock(t)
+
+				secrets, err := f.svc.GetSecrets([]dbus.ObjectPath{f.item.Path()}, f.session)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(secrets) != 0 {
+					t.Errorf("expected no secrets but got %d", len(secrets))
+				}
+			},
+		},
+		{
+			name: "replace updates the item with the same attributes",
+			check: func(t *testing.T, f *fixture) {
+				item, err := f.collection.CreateItem(f.session, "db2", map[string]string{"service": "db"}, keyring.SecretValue("new"), "text/plain", true)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if item.Path() != f.item.Path() {
+					t.Errorf("expected %s to be replaced but got %s", f.item.Path(), item.Path())
+				}
+
+				secret, err := item.GetSecret(f.session)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if secret.Value.Reveal() != "new" {
+					t.Errorf("expected the secret to be replaced")
+				}
+			},
+		},
+		{
+			name: "aliases resolve to collections",
+			check: func(t *testing.T, f *fixture) {
+				if _, err := f.svc.ReadAlias("work"); err != keyring.ErrUnknownAlias {
+					t.Errorf("expected ErrUnknownAlias but got %v", err)
+				}
+
+				if err := f.svc.SetAlias("work", "/org/freedesktop/secrets/collection/unknown"); errorName(err) != keyring.ErrorNoSuchObject {
+					t.Errorf("expected %s but got %v", keyring.ErrorNoSuchObject, err)
+				}
+
+				if err := f.svc.SetAlias("work", f.collection.Path()); err != nil {
+					t.Fatal(err)
+				}
+
+				col, err := f.svc.GetCollectionByAlias("work")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if col.Path() != f.collection.Path() {
+					t.Errorf("expected %s but got %s", f.collection.Path(), col.Path())
+				}
+
+				if err := f.svc.RemoveAlias("work"); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := f.svc.GetCollectionByAlias("work"); err != keyring.ErrUnknownAlias {
+					t.Errorf("expected ErrUnknownAlias but got %v", err)
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.check(t, newFixture(t))
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyringfake
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+// Session is an in-memory implementation of keyring.Session
+type Session struct {
+	svc  *Service
+	path dbus.ObjectPath
+}
+
+// Path returns the object path of the session
+func (s *Session) Path() dbus.ObjectPath {
+	return s.path
+}
+
+// Close closes the session. Secrets can no longer be transferred using it
+func (s *Session) Close() error {
+	s.svc.l.Lock()
+	defer s.svc.l.Unlock()
+
+	if !s.svc.sessions[s.path] {
+		return errUnknownObject(s.path)
+	}
+
+	delete(s.svc.sessions, s.path)
+	return nil
+}
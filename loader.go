@@ -0,0 +1,238 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// StructTag is the struct tag used by LoadInto
+const StructTag = "keyring"
+
+// LoadInto fills the string and []byte fields of the struct pointed to by v
+// that have a "keyring" tag with secrets. The tag holds either a comma
+// separated list of attributes or a secret URI:
+//
+//	type Config struct {
+//		DBPassword string `keyring:"service=db,user=app"`
+//		APIToken   []byte `keyring:"secret-service://alias/default?service=api"`
+//	}
+//
+// Nested structs and non-nil pointers to structs are filled as well.
+// Locked items are unlocked as required
+func LoadInto(ctx context.Context, svc SecretService, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("LoadInto: expected a non-nil pointer to a struct but got %T", v)
+	}
+
+	l := &loader{
+		ctx: ctx,
+		svc: svc,
+	}
+	defer l.close()
+
+	return l.fill(rv.Elem())
+}
+
+// loader holds the state of a single LoadInto call
+type loader struct {
+	ctx     context.Context
+	svc     SecretService
+	session Session
+}
+
+// fill fills all tagged fields of the struct v
+func (l *loader) fill(v reflect.Value) error {
+	t := v.Type()
+
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		fv := v.Field(idx)
+
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		tag, ok := field.Tag.Lookup(StructTag)
+		if !ok || tag == "-" {
+			if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+
+			if fv.Kind() == reflect.Struct {
+				if err := l.fill(fv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		value, err := l.lookup(tag)
+		if err != nil {
+			return &SecretRefError{Name: t.Name() + "." + field.Name, Err: err}
+		}
+
+		switch {
+		case fv.Kind() == reflect.String:
+			fv.SetString(string(value))
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Uint8:
+			fv.SetBytes(value)
+		default:
+			return fmt.Errorf("%s.%s: unsupported field type %s", t.Name(), field.Name, fv.Type())
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the secret referenced by tag
+func (l *loader) lookup(tag string) ([]byte, error) {
+	if strings.HasPrefix(tag, URIScheme+":") {
+		s, err := Resolve(l.ctx, l.svc, tag)
+		if err != nil {
+			return nil, err
+		}
+		return s.Value.Bytes(), nil
+	}
+
+	attrs, err := parseAttributeList(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.session == nil {
+		if l.session, err = l.svc.OpenSession(); err != nil {
+			return nil, err
+		}
+	}
+
+	return lookupAttributes(l.ctx, l.svc, l.session, attrs)
+}
+
+// close closes the session opened by lookup
+func (l *loader) close() {
+	if l.session != nil {
+		_ = l.session.Close()
+	}
+}
+
+// SignalConn is a connection delivering DBus signals. It is implemented by
+// *dbus.Conn and *Client
+type SignalConn interface {
+	Signal(ch chan<- *dbus.Signal)
+	RemoveSignal(ch chan<- *dbus.Signal)
+	AddMatchSignal(options ...dbus.MatchOption) error
+	RemoveMatchSignal(options ...dbus.MatchOption) error
+}
+
+// WatchInto loads the secrets referenced by the struct v points to like
+// LoadInto and reloads them whenever an item of the secret service is
+// created, changed or deleted. v itself is never modified: each load fills a
+// copy of *v which is passed to reload, so the caller can swap it in while
+// holding its own lock. If a reload fails, reload is called with a nil value
+// and the error and the previously loaded copy stays valid. An error of the
+// initial load is returned. WatchInto blocks until ctx is cancelled
+func WatchInto(ctx context.Context, conn SignalConn, svc SecretService, v interface{}, reload func(next interface{}, err error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("WatchInto: expected a non-nil pointer to a struct but got %T", v)
+	}
+
+	matches := [][]dbus.MatchOption{
+		{dbus.WithMatchInterface(CollectionInterface), dbus.WithMatchMember("ItemCreated")},
+		{dbus.WithMatchInterface(CollectionInterface), dbus.WithMatchMember("ItemChanged")},
+		{dbus.WithMatchInterface(CollectionInterface), dbus.WithMatchMember("ItemDeleted")},
+	}
+
+	for _, m := range matches {
+		if err := conn.AddMatchSignal(m...); err != nil {
+			return err
+		}
+		defer conn.RemoveMatchSignal(m...)
+	}
+
+	sig := make(chan *dbus.Signal, 10)
+	conn.Signal(sig)
+	defer conn.RemoveSignal(sig)
+
+	next, err := loadCopy(ctx, svc, rv)
+	if err != nil {
+		return err
+	}
+	reload(next, nil)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case s, ok := <-sig:
+			if !ok {
+				return dbus.ErrClosed
+			}
+
+			switch s.Name {
+			case collectionSignalItemCreated, collectionSignalItemChanged, collectionSignalItemDeleted:
+			default:
+				continue
+			}
+
+			if next, err := loadCopy(ctx, svc, rv); err != nil {
+				reload(nil, err)
+			} else {
+				reload(next, nil)
+			}
+		}
+	}
+}
+
+// loadCopy calls LoadInto on a copy of the struct v points to and returns
+// the copy
+func loadCopy(ctx context.Context, svc SecretService, v reflect.Value) (interface{}, error) {
+	c := reflect.New(v.Type().Elem())
+	copyStruct(c.Elem(), v.Elem())
+
+	if err := LoadInto(ctx, svc, c.Interface()); err != nil {
+		return nil, err
+	}
+
+	return c.Interface(), nil
+}
+
+// copyStruct copies the struct src to dst. Pointers to structs followed by
+// LoadInto are copied as well so that filling dst does not modify src
+func copyStruct(dst, src reflect.Value) {
+	dst.Set(src)
+
+	t := src.Type()
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		fv := dst.Field(idx)
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if tag, ok := field.Tag.Lookup(StructTag); ok && tag != "-" {
+			continue
+		}
+
+		switch {
+		case fv.Kind() == reflect.Struct:
+			copyStruct(fv, src.Field(idx))
+
+		case fv.Kind() == reflect.Ptr && !fv.IsNil() && fv.Elem().Kind() == reflect.Struct:
+			p := reflect.New(fv.Type().Elem())
+			copyStruct(p.Elem(), fv.Elem())
+			fv.Set(p)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+type watchedConfig struct {
+	Name     string
+	Password string `keyring:"service=db"`
+	Nested   *struct {
+		Token string `keyring:"service=api"`
+	}
+}
+
+func TestWatchInto(t *testing.T) {
+	fake := keyringfake.New()
+	bus := startBus(t, fake)
+	defer bus.Close()
+
+	session, err := fake.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := fake.GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := col.CreateItem(session.Path(), "db", map[string]string{"service": "db"}, keyring.SecretValue("v1"), "text/plain", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := col.CreateItem(session.Path(), "api", map[string]string{"service": "api"}, keyring.SecretValue("token"), "text/plain", false); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := keyring.Connect(keyring.ConnectOptions{Address: bus.Address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	svc, err := client.SecretService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &watchedConfig{Name: "app"}
+	cfg.Nested = &struct {
+		Token string `keyring:"service=api"`
+	}{}
+
+	loaded := make(chan *watchedConfig, 4)
+	go keyring.WatchInto(ctx, client, svc, cfg, func(next interface{}, err error) {
+		if err != nil {
+			t.Errorf("reload failed: %s", err)
+			return
+		}
+		loaded <- next.(*watchedConfig)
+	})
+
+	next := func() *watchedConfig {
+		select {
+		case c := <-loaded:
+			return c
+		case <-time.After(2 * time.Second):
+			t.Fatal("no configuration loaded")
+			return nil
+		}
+	}
+
+	first := next()
+	if first.Name != "app" || first.Password != "v1" || first.Nested.Token != "token" {
+		t.Errorf("unexpected configuration %+v", first)
+	}
+
+	if err := item.SetSecret(session.Path(), keyring.SecretValue("v2"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	if second := next(); second.Password != "v2" || second.Nested == first.Nested {
+		t.Errorf("expected a new copy with the changed secret but got %+v", second)
+	}
+
+	if first.Password != "v1" || cfg.Password != "" || cfg.Nested.Token != "" {
+		t.Errorf("previously loaded configurations have been modified")
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// EventKind is the kind of an observed Event
+type EventKind int
+
+// Kinds of observed events
+const (
+	// EventCall is a method call
+	EventCall EventKind = iota
+
+	// EventGetProperty reads a property
+	EventGetProperty
+
+	// EventSetProperty writes a property
+	EventSetProperty
+
+	// EventPrompt is a prompt from calling Prompt until it completed
+	EventPrompt
+
+	// EventSignal is a received signal
+	EventSignal
+)
+
+// String returns the name of k
+func (k EventKind) String() string {
+	switch k {
+	case EventCall:
+		return "call"
+	case EventGetProperty:
+		return "get-property"
+	case EventSetProperty:
+		return "set-property"
+	case EventPrompt:
+		return "prompt"
+	case EventSignal:
+		return "signal"
+	}
+
+	return "unknown"
+}
+
+// Event describes an observed DBus call, property access, prompt or signal.
+// Events never contain arguments or results so secret values are never
+// passed to an Observer
+type Event struct {
+	// Kind of the event
+	Kind EventKind
+
+	// Method is the method, property or signal name including the interface
+	Method string
+
+	// Path is the object path of the called object or of the signal sender
+	Path dbus.ObjectPath
+
+	// Duration of the call or prompt. Zero for signals
+	Duration time.Duration
+
+	// Err is the error returned by the call. For prompts it is
+	// ErrPromptDismissed if the user dismissed the prompt
+	Err error
+}
+
+// Observer is notified about each DBus call, property access, prompt and
+// signal. Observe is called after the call completed and must not block
+type Observer interface {
+	Observe(e Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface
+type ObserverFunc func(e Event)
+
+// Observe calls fn(e)
+func (fn ObserverFunc) Observe(e Event) {
+	fn(e)
+}
+
+// MultiObserver returns an Observer that notifies all observers
+func MultiObserver(observers ...Observer) Observer {
+	return ObserverFunc(func(e Event) {
+		for _, o := range observers {
+			o.Observe(e)
+		}
+	})
+}
+
+// ObserveSecretService returns a client to the SecretService on conn that
+// notifies o about each call, property access, prompt and signal
+func ObserveSecretService(conn *dbus.Conn, o Observer) (SecretService, error) {
+	return newSecretService(newObservingConn(conn, o))
+}
+
+// observingConn is a busConn that notifies an Observer
+type observingConn struct {
+	connWrapper
+	observer Observer
+	signals  *signalHub
+}
+
+// newObservingConn returns an observingConn for conn that reports signals to o
+func newObservingConn(conn busConn, o Observer) *observingConn {
+	oc := &observingConn{
+		connWrapper: connWrapper{conn},
+		observer:    o,
+	}
+
+	oc.signals = newSignalHub(conn, func(s *dbus.Signal) {
+		o.Observe(Event{
+			Kind:   EventSignal,
+			Method: s.Name,
+			Path:   s.Path,
+		})
+	})
+
+	return oc
+}
+
+// signalHub subscribes once to a busConn and passes each signal to a hook
+// before delivering it to the channels registered using add. Hooks thus see
+// each signal once regardless of the number of channels
+type signalHub struct {
+	conn busConn
+	hook func(s *dbus.Signal)
+	in   chan *dbus.Signal
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	l       sync.Mutex
+	targets map[chan<- *dbus.Signal]*signalTarget
+}
+
+// newSignalHub returns a signalHub subscribed to conn. It stops once conn is
+// closed
+func newSignalHub(conn busConn, hook func(s *dbus.Signal)) *signalHub {
+	h := &signalHub{
+		conn:    conn,
+		hook:    hook,
+		in:      make(chan *dbus.Signal, 64),
+		done:    make(chan struct{}),
+		targets: make(map[chan<- *dbus.Signal]*signalTarget),
+	}
+
+	conn.Signal(h.in)
+
+	h.wg.Add(1)
+	go h.run()
+
+	notifyClose(conn, h.stop)
+
+	return h
+}
+
+// run passes the signals received from conn to the hook and all channels
+// until stop is called or conn is closed
+func (h *signalHub) run() {
+	defer h.wg.Done()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case s, ok := <-h.in:
+			if !ok {
+				return
+			}
+
+			h.hook(s)
+
+			h.l.Lock()
+			for _, t := range h.targets {
+				t.push(s)
+			}
+			h.l.Unlock()
+		}
+	}
+}
+
+// add registers ch to receive all signals
+func (h *signalHub) add(ch chan<- *dbus.Signal) {
+	h.l.Lock()
+	defer h.l.Unlock()
+
+	if _, ok := h.targets[ch]; !ok {
+		h.targets[ch] = newSignalTarget(ch)
+	}
+}
+
+// remove removes ch from the channels registered using add
+func (h *signalHub) remove(ch chan<- *dbus.Signal) {
+	h.l.Lock()
+	t, ok := h.targets[ch]
+	delete(h.targets, ch)
+	h.l.Unlock()
+
+	if ok {
+		t.stop()
+	}
+}
+
+// stop unsubscribes from conn and stops delivering signals
+func (h *signalHub) stop() {
+	h.conn.RemoveSignal(h.in)
+	close(h.done)
+	h.wg.Wait()
+
+	h.l.Lock()
+	targets := h.targets
+	h.targets = make(map[chan<- *dbus.Signal]*signalTarget)
+	h.l.Unlock()
+
+	for _, t := range targets {
+		t.stop()
+	}
+}
+
+// Object returns an observed handle to the object identified by dest and path
+func (oc *observingConn) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	o := &observedObject{observer: oc.observer}
+	o.busObject = busObject{oc.busConn.Object(dest, path), o.CallWithContext}
+
+	return o
+}
+
+// Signal registers ch to receive all signals. Signals are reported to the
+// observer once before they are delivered to the registered channels
+func (oc *observingConn) Signal(ch chan<- *dbus.Signal) {
+	oc.signals.add(ch)
+}
+
+// RemoveSignal removes ch from the channels registered using Signal
+func (oc *observingConn) RemoveSignal(ch chan<- *dbus.Signal) {
+	oc.signals.remove(ch)
+}
+
+// observePrompt notifies the observers in the wrapper chain of conn, if any,
+// about a completed prompt
+func observePrompt(conn busConn, path dbus.ObjectPath, start time.Time, err error) {
+	duration := time.Since(start)
+
+	walkConn(conn, func(c busConn) bool {
+		if oc, ok := c.(*observingConn); ok {
+			oc.observer.Observe(Event{
+				Kind:     EventPrompt,
+				Method:   promptMethodPrompt,
+				Path:     path,
+				Duration: duration,
+				Err:      err,
+			})
+		}
+		return false
+	})
+}
+
+// observedObject notifies an Observer about calls and property accesses
+type observedObject struct {
+	busObject
+	observer Observer
+}
+
+// observe notifies the observer about an event that started at start
+func (o *observedObject) observe(kind EventKind, method string, start time.Time, err error) {
+	o.observer.Observe(Event{
+		Kind:     kind,
+		Method:   method,
+		Path:     o.Path(),
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+// CallWithContext implements dbus.BusObject
+func (o *observedObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	start := time.Now()
+	call := o.BusObject.CallWithContext(ctx, method, flags, args...)
+	o.observe(EventCall, method, start, call.Err)
+
+	return call
+}
+
+// GetProperty implements dbus.BusObject
+func (o *observedObject) GetProperty(p string) (dbus.Variant, error) {
+	start := time.Now()
+	v, err := o.BusObject.GetProperty(p)
+	o.observe(EventGetProperty, p, start, err)
+
+	return v, err
+}
+
+// SetProperty implements dbus.BusObject
+func (o *observedObject) SetProperty(p string, v interface{}) error {
+	start := time.Now()
+	err := o.BusObject.SetProperty(p, v)
+	o.observe(EventSetProperty, p, start, err)
+
+	return err
+}
+
+// CallStats holds the statistics collected by a CounterObserver for a
+// single kind and method
+type CallStats struct {
+	Count         uint64        `json:"count"`
+	Errors        uint64        `json:"errors"`
+	TotalDuration time.Duration `json:"totalDuration"`
+	MaxDuration   time.Duration `json:"maxDuration"`
+}
+
+// CounterObserver is an Observer that counts events and errors and tracks
+// their durations per kind and method. It implements expvar.Var so it can be
+// published using expvar.Publish
+type CounterObserver struct {
+	l     sync.Mutex
+	stats map[string]*CallStats
+}
+
+// NewCounterObserver returns a new CounterObserver
+func NewCounterObserver() *CounterObserver {
+	return &CounterObserver{
+		stats: make(map[string]*CallStats),
+	}
+}
+
+// Observe implements Observer
+func (c *CounterObserver) Observe(e Event) {
+	key := e.Kind.String() + " " + e.Method
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	s, ok := c.stats[key]
+	if !ok {
+		s = &CallStats{}
+		c.stats[key] = s
+	}
+
+	s.Count++
+	if e.Err != nil {
+		s.Errors++
+	}
+
+	s.TotalDuration += e.Duration
+	if e.Duration > s.MaxDuration {
+		s.MaxDuration = e.Duration
+	}
+}
+
+// Snapshot returns a copy of the statistics keyed by "<kind> <method>"
+func (c *CounterObserver) Snapshot() map[string]CallStats {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	snapshot := make(map[string]CallStats, len(c.stats))
+	for k, s := range c.stats {
+		snapshot[k] = *s
+	}
+
+	return snapshot
+}
+
+// String returns the statistics as JSON
+func (c *CounterObserver) String() string {
+	blob, err := json.Marshal(c.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+
+	return string(blob)
+}
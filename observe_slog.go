@@ -0,0 +1,33 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+//go:build go1.21
+// +build go1.21
+
+package keyring
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogObserver returns an Observer that logs each event to logger. Successful
+// events are logged at debug level and failed ones at warn level
+func SlogObserver(logger *slog.Logger) Observer {
+	return ObserverFunc(func(e Event) {
+		level := slog.LevelDebug
+		attrs := []slog.Attr{
+			slog.String("kind", e.Kind.String()),
+			slog.String("method", e.Method),
+			slog.String("path", string(e.Path)),
+			slog.Duration("duration", e.Duration),
+		}
+
+		if e.Err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", e.Err.Error()))
+		}
+
+		logger.LogAttrs(context.Background(), level, "secret service "+e.Kind.String(), attrs...)
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+// eventLog keeps all observed events
+type eventLog struct {
+	l      sync.Mutex
+	events []keyring.Event
+}
+
+func (log *eventLog) Observe(e keyring.Event) {
+	log.l.Lock()
+	defer log.l.Unlock()
+
+	log.events = append(log.events, e)
+}
+
+// count returns the number of events of kind for method
+func (log *eventLog) count(kind keyring.EventKind, method string) int {
+	log.l.Lock()
+	defer log.l.Unlock()
+
+	n := 0
+	for _, e := range log.events {
+		if e.Kind == kind && e.Method == method {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestObserver(t *testing.T) {
+	fake := keyringfake.New()
+	col, err := fake.GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fake.Lock([]dbus.ObjectPath{col.Path()}); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := startBus(t, fake)
+	defer bus.Close()
+
+	log := &eventLog{}
+	client, err := keyring.Connect(keyring.ConnectOptions{
+		Address:  bus.Address,
+		Observer: log,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	svc, err := client.SecretService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a second subscriber besides the prompt
+	signals := make(chan *dbus.Signal, 16)
+	client.Signal(signals)
+
+	if _, err := svc.Unlock([]dbus.ObjectPath{col.Path()}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitSignal(t, signals, keyring.PromptInterface+".Completed", "")
+
+	if _, err := svc.GetDefaultCollection(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		kind   keyring.EventKind
+		method string
+	}{
+		{keyring.EventCall, keyring.ServiceInterface + ".Unlock"},
+		{keyring.EventCall, keyring.PromptInterface + ".Prompt"},
+		{keyring.EventPrompt, keyring.PromptInterface + ".Prompt"},
+		{keyring.EventSignal, keyring.PromptInterface + ".Completed"},
+		{keyring.EventGetProperty, keyring.CollectionInterface + ".Label"},
+	}
+
+	for _, c := range cases {
+		if n := log.count(c.kind, c.method); n != 1 {
+			t.Errorf("expected one %s event for %s but got %d", c.kind, c.method, n)
+		}
+	}
+
+	log.l.Lock()
+	defer log.l.Unlock()
+
+	for _, e := range log.events {
+		if e.Kind == keyring.EventPrompt && e.Err != nil {
+			t.Errorf("unexpected prompt error: %s", e.Err)
+		}
+	}
+}
@@ -4,7 +4,9 @@
 package keyring
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 )
@@ -30,6 +32,11 @@ type Prompt interface {
 
 // GetPrompt returns a Prompt client for the given path
 func GetPrompt(conn *dbus.Conn, path dbus.ObjectPath) Prompt {
+	return newPrompt(conn, path)
+}
+
+// newPrompt returns a Prompt client for the given path on conn
+func newPrompt(conn busConn, path dbus.ObjectPath) Prompt {
 	obj := conn.Object(SecretServiceDest, path)
 
 	return &prompt{
@@ -41,7 +48,7 @@ func GetPrompt(conn *dbus.Conn, path dbus.ObjectPath) Prompt {
 
 // prompt implements the Prompt interface
 type prompt struct {
-	conn *dbus.Conn
+	conn busConn
 	path dbus.ObjectPath
 	obj  dbus.BusObject
 }
@@ -63,7 +70,14 @@ func (p *prompt) Prompt(windowID string) (<-chan *dbus.Variant, error) {
 	sig := make(chan *dbus.Signal, 1)
 	p.conn.Signal(sig)
 
+	start := time.Now()
+
 	go func() {
+		var promptErr error
+		defer func() {
+			observePrompt(p.conn, p.path, start, promptErr)
+		}()
+
 		defer close(sig)
 		defer p.conn.RemoveSignal(sig)
 
@@ -80,12 +94,14 @@ func (p *prompt) Prompt(windowID string) (<-chan *dbus.Variant, error) {
 		var result dbus.Variant
 		if err := dbus.Store(res, &dismissed, &result); err != nil {
 			// how to handle that?
+			promptErr = err
 			ch <- nil
 			log.Println(err.Error())
 			return
 		}
 
 		if dismissed {
+			promptErr = ErrPromptDismissed
 			ch <- nil
 			return
 		}
@@ -104,3 +120,22 @@ func (p *prompt) Prompt(windowID string) (<-chan *dbus.Variant, error) {
 func (p *prompt) Dismiss() error {
 	return p.obj.Call(promptMethodDismiss, 0).Err
 }
+
+// runPrompt performs the prompt at path and waits for it to complete. If ctx
+// is cancelled before the prompt completes it is dismissed and ctx.Err() is
+// returned. A nil result is returned if the prompt has been dismissed by the user
+func runPrompt(ctx context.Context, conn busConn, path dbus.ObjectPath) (*dbus.Variant, error) {
+	p := newPrompt(conn, path)
+	res, err := p.Prompt("")
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case result := <-res:
+		return result, nil
+	case <-ctx.Done():
+		_ = p.Dismiss()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Provider identifies the application implementing the secret service
+type Provider string
+
+// Known secret service providers
+const (
+	ProviderUnknown      Provider = "unknown"
+	ProviderGnomeKeyring Provider = "gnome-keyring"
+	ProviderKeePassXC    Provider = "keepassxc"
+	ProviderKWallet      Provider = "kwallet"
+	ProviderOO7          Provider = "oo7"
+)
+
+const (
+	busDest = "org.freedesktop.DBus"
+	busPath = "/org/freedesktop/DBus"
+
+	busMethodGetNameOwner               = busDest + ".GetNameOwner"
+	busMethodGetConnectionUnixProcessID = busDest + ".GetConnectionUnixProcessID"
+
+	busErrorNameHasNoOwner = busDest + ".Error.NameHasNoOwner"
+	busErrorUnknownMethod  = busDest + ".Error.UnknownMethod"
+)
+
+// ErrNoProvider is returned if no application owns SecretServiceDest
+var ErrNoProvider = errors.New("no secret service provider running")
+
+// providerExecutables maps executable names to providers
+var providerExecutables = map[string]Provider{
+	"gnome-keyring-daemon": ProviderGnomeKeyring,
+	"keepassxc":            ProviderKeePassXC,
+	"ksecretd":             ProviderKWallet,
+	"kwalletd5":            ProviderKWallet,
+	"kwalletd6":            ProviderKWallet,
+	"oo7-daemon":           ProviderOO7,
+}
+
+// Capabilities describes the application implementing the secret service.
+// Only the session algorithms and alias support are probed, the latter
+// being used to skip aliases. Whether CreateItem prompts and whether its
+// replace flag is honoured cannot be probed without side effects and is not
+// detected: CreateItem handles a prompt whenever one is returned and
+// Collection.Upsert does not depend on the replace flag
+type Capabilities struct {
+	// Provider is the detected provider
+	Provider Provider
+
+	// Owner is the unique bus name of the provider
+	Owner string
+
+	// PID is the process ID of the provider or 0 if unknown
+	PID uint32
+
+	// Executable is the path of the provider executable if available
+	Executable string
+
+	// Algorithms holds the supported session algorithms
+	Algorithms []string
+
+	// Aliases is true if ReadAlias and SetAlias are supported
+	Aliases bool
+}
+
+// SupportsAlgorithm returns true if alg is a supported session algorithm
+func (c *Capabilities) SupportsAlgorithm(alg string) bool {
+	for _, a := range c.Algorithms {
+		if a == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DetectProvider identifies the application owning SecretServiceDest on conn
+// and probes its capabilities. ErrNoProvider is returned if the name has no
+// owner
+func DetectProvider(conn *dbus.Conn) (*Capabilities, error) {
+	return detectProvider(conn)
+}
+
+// detectProvider implements DetectProvider for any busConn
+func detectProvider(conn busConn) (*Capabilities, error) {
+	bus := conn.Object(busDest, busPath)
+
+	var owner string
+	if err := bus.Call(busMethodGetNameOwner, 0, SecretServiceDest).Store(&owner); err != nil {
+		if isDBusError(err, busErrorNameHasNoOwner) {
+			return nil, ErrNoProvider
+		}
+		return nil, err
+	}
+
+	caps := &Capabilities{
+		Provider: ProviderUnknown,
+		Owner:    owner,
+	}
+
+	// the process ID is not available for all transports
+	if err := bus.Call(busMethodGetConnectionUnixProcessID, 0, owner).Store(&caps.PID); err == nil {
+		caps.Executable, caps.Provider = identifyProcess(caps.PID)
+	}
+
+	if err := caps.probe(conn); err != nil {
+		return nil, err
+	}
+
+	return caps, nil
+}
+
+// identifyProcess returns the executable and the provider of the process pid
+func identifyProcess(pid uint32) (string, Provider) {
+	dir := filepath.Join("/proc", strconv.FormatUint(uint64(pid), 10))
+
+	var names []string
+
+	// exe is not readable for processes of other users
+	exe, err := os.Readlink(filepath.Join(dir, "exe"))
+	if err == nil {
+		names = append(names, filepath.Base(strings.TrimSuffix(exe, " (deleted)")))
+	}
+
+	if cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		if argv0 != "" {
+			names = append(names, filepath.Base(argv0))
+		}
+	}
+
+	if comm, err := ioutil.ReadFile(filepath.Join(dir, "comm")); err == nil {
+		names = append(names, strings.TrimSpace(string(comm)))
+	}
+
+	for _, n := range names {
+		if p, ok := providerExecutables[n]; ok {
+			return exe, p
+		}
+	}
+
+	return exe, ProviderUnknown
+}
+
+// probe fills the capabilities that can be detected by calling the provider
+func (c *Capabilities) probe(conn busConn) error {
+	obj := conn.Object(SecretServiceDest, SecretServicePath)
+
+	probes := []struct {
+		alg   string
+		input interface{}
+	}{
+		{AlgPlain, ""},
+		{AlgDH, dhProbeKey()},
+	}
+
+	for _, p := range probes {
+		var output dbus.Variant
+		var path dbus.ObjectPath
+
+		err := obj.Call(serviceMethodOpenSession, 0, p.alg, dbus.MakeVariant(p.input)).Store(&output, &path)
+		if err != nil {
+			continue
+		}
+
+		c.Algorithms = append(c.Algorithms, p.alg)
+		_ = conn.Object(SecretServiceDest, path).Call(sessionMethodClose, 0).Err
+	}
+
+	if len(c.Algorithms) == 0 {
+		return errors.New("provider does not support any session algorithm")
+	}
+
+	err := obj.Call(serviceMethodReadAlias, 0, DefaultAlias).Err
+	if err != nil && !isDBusError(err, busErrorUnknownMethod) {
+		return err
+	}
+	c.Aliases = err == nil
+
+	return nil
+}
+
+// dhProbeKey returns a public key for probing AlgDH. It is the generator of
+// the 1024 bit MODP group which is a valid public key
+func dhProbeKey() []byte {
+	key := make([]byte, 128)
+	key[len(key)-1] = 2
+	return key
+}
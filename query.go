@@ -0,0 +1,382 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SortOrder defines the property used to sort the results of a Query
+type SortOrder int
+
+const (
+	// SortNone keeps the order returned by the secret service
+	SortNone SortOrder = iota
+
+	// SortByLabel sorts items by their label
+	SortByLabel
+
+	// SortByCreated sorts items by their creation time
+	SortByCreated
+
+	// SortByModified sorts items by their last modification time
+	SortByModified
+)
+
+// Query describes a client-side search for items. The exact attribute matches
+// in Attributes are passed to the SearchItems method of the secret service while
+// all other conditions are evaluated locally. The zero value matches all items
+type Query struct {
+	// Attributes must match exactly and are passed to SearchItems
+	Attributes map[string]string
+
+	// Label is a glob pattern (see globMatch) the item label must match
+	Label string
+
+	// LabelRegexp is a regular expression the item label must match
+	LabelRegexp *regexp.Regexp
+
+	// AttributeGlobs maps attribute names to glob patterns (see globMatch)
+	// the attribute value must match
+	AttributeGlobs map[string]string
+
+	// AttributeRegexps maps attribute names to regular expressions the
+	// attribute value must match
+	AttributeRegexps map[string]*regexp.Regexp
+
+	// HasAttributes lists attribute names that must be present
+	HasAttributes []string
+
+	// MissingAttributes lists attribute names that must not be present
+	MissingAttributes []string
+
+	// CreatedAfter and CreatedBefore limit the creation time of items.
+	// A zero time disables the check
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// ModifiedAfter and ModifiedBefore limit the modification time of items.
+	// A zero time disables the check
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// Locked, if set, limits the result to locked or unlocked items
+	Locked *bool
+
+	// SortBy defines how the result should be sorted
+	SortBy SortOrder
+
+	// Descending reverses the sort order
+	Descending bool
+
+	// Limit limits the number of items returned. Zero means no limit
+	Limit int
+}
+
+// queryItem caches the properties of an item while evaluating a query
+type queryItem struct {
+	item     Item
+	label    string
+	created  time.Time
+	modified time.Time
+}
+
+// Filter applies all client-side conditions of the query to items, sorts
+// the result and applies the limit. Exact attribute matches are checked as
+// well so Filter can be used on any list of items
+func (q *Query) Filter(items []Item) ([]Item, error) {
+	var matches []*queryItem
+
+	for _, i := range items {
+		qi, ok, err := q.match(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			matches = append(matches, qi)
+		}
+	}
+
+	if q.SortBy != SortNone {
+		sort.SliceStable(matches, func(a, b int) bool {
+			x, y := matches[a], matches[b]
+			if q.Descending {
+				x, y = y, x
+			}
+
+			switch q.SortBy {
+			case SortByLabel:
+				return x.label < y.label
+			case SortByCreated:
+				return x.created.Before(y.created)
+			case SortByModified:
+				return x.modified.Before(y.modified)
+			}
+			return false
+		})
+	}
+
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+
+	result := make([]Item, len(matches))
+	for idx, m := range matches {
+		result[idx] = m.item
+	}
+
+	return result, nil
+}
+
+// needsLabel returns true if the label of an item is required to evaluate the query
+func (q *Query) needsLabel() bool {
+	return q.Label != "" || q.LabelRegexp != nil || q.SortBy == SortByLabel
+}
+
+// needsAttributes returns true if the attributes of an item are required to evaluate the query
+func (q *Query) needsAttributes() bool {
+	return len(q.Attributes) > 0 ||
+		len(q.AttributeGlobs) > 0 ||
+		len(q.AttributeRegexps) > 0 ||
+		len(q.HasAttributes) > 0 ||
+		len(q.MissingAttributes) > 0
+}
+
+// match checks if i matches all conditions of the query
+func (q *Query) match(i Item) (*queryItem, bool, error) {
+	qi := &queryItem{item: i}
+
+	if q.needsLabel() {
+		l, err := i.GetLabel()
+		if err != nil {
+			return nil, false, err
+		}
+		qi.label = l
+
+		if q.Label != "" {
+			ok, err := globMatch(q.Label, l)
+			if err != nil || !ok {
+				return nil, false, err
+			}
+		}
+
+		if q.LabelRegexp != nil && !q.LabelRegexp.MatchString(l) {
+			return nil, false, nil
+		}
+	}
+
+	if q.needsAttributes() {
+		attrs, err := i.GetAttributes()
+		if err != nil {
+			return nil, false, err
+		}
+
+		ok, err := q.matchAttributes(attrs)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+	}
+
+	if q.Locked != nil {
+		locked, err := i.Locked()
+		if err != nil {
+			return nil, false, err
+		}
+
+		if locked != *q.Locked {
+			return nil, false, nil
+		}
+	}
+
+	if !q.CreatedAfter.IsZero() || !q.CreatedBefore.IsZero() || q.SortBy == SortByCreated {
+		t, err := i.GetCreated()
+		if err != nil {
+			return nil, false, err
+		}
+		qi.created = t
+
+		if !inRange(t, q.CreatedAfter, q.CreatedBefore) {
+			return nil, false, nil
+		}
+	}
+
+	if !q.ModifiedAfter.IsZero() || !q.ModifiedBefore.IsZero() || q.SortBy == SortByModified {
+		t, err := i.GetModified()
+		if err != nil {
+			return nil, false, err
+		}
+		qi.modified = t
+
+		if !inRange(t, q.ModifiedAfter, q.ModifiedBefore) {
+			return nil, false, nil
+		}
+	}
+
+	return qi, true, nil
+}
+
+// matchAttributes checks all attribute related conditions of the query
+func (q *Query) matchAttributes(attrs map[string]string) (bool, error) {
+	for k, v := range q.Attributes {
+		if attrs[k] != v {
+			return false, nil
+		}
+	}
+
+	for _, k := range q.HasAttributes {
+		if _, ok := attrs[k]; !ok {
+			return false, nil
+		}
+	}
+
+	for _, k := range q.MissingAttributes {
+		if _, ok := attrs[k]; ok {
+			return false, nil
+		}
+	}
+
+	for k, pattern := range q.AttributeGlobs {
+		v, ok := attrs[k]
+		if !ok {
+			return false, nil
+		}
+
+		matched, err := globMatch(pattern, v)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	for k, re := range q.AttributeRegexps {
+		v, ok := attrs[k]
+		if !ok || !re.MatchString(v) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// inRange returns true if t is after "after" and before "before". Zero
+// values are ignored
+func inRange(t, after, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+
+	if !before.IsZero() && t.After(before) {
+		return false
+	}
+
+	return true
+}
+
+// globMatch reports whether s matches the glob pattern. The syntax is the one
+// of path.Match but * and ? match any character including / so that labels
+// like "Git: https://host/repo" match "Git: *"
+func globMatch(pattern, s string) (bool, error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(s), nil
+}
+
+// globRegexp converts the glob pattern into an anchored regular expression.
+// path.ErrBadPattern is returned for malformed patterns
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`^(?s:`)
+
+	for len(pattern) > 0 {
+		r, n := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[n:]
+
+		switch r {
+		case '*':
+			b.WriteString(`.*`)
+
+		case '?':
+			b.WriteString(`.`)
+
+		case '\\':
+			if pattern == "" {
+				return nil, path.ErrBadPattern
+			}
+			r, n = utf8.DecodeRuneInString(pattern)
+			pattern = pattern[n:]
+			b.WriteString(regexp.QuoteMeta(string(r)))
+
+		case '[':
+			rest, err := globClass(&b, pattern)
+			if err != nil {
+				return nil, err
+			}
+			pattern = rest
+
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	b.WriteString(`)$`)
+
+	return regexp.Compile(b.String())
+}
+
+// globClass writes the character class at the start of pattern, following an
+// opening bracket, to b and returns the rest of the pattern
+func globClass(b *strings.Builder, pattern string) (string, error) {
+	b.WriteByte('[')
+	if strings.HasPrefix(pattern, "^") {
+		b.WriteByte('^')
+		pattern = pattern[1:]
+	}
+
+	empty := true
+	for {
+		if pattern == "" {
+			return "", path.ErrBadPattern
+		}
+
+		r, n := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[n:]
+
+		switch {
+		case r == ']' && !empty:
+			b.WriteByte(']')
+			return pattern, nil
+
+		case r == ']':
+			return "", path.ErrBadPattern
+
+		case r == '-' && !empty && pattern != "" && pattern[0] != ']':
+			b.WriteByte('-')
+			continue
+
+		case r == '\\':
+			if pattern == "" {
+				return "", path.ErrBadPattern
+			}
+			r, n = utf8.DecodeRuneInString(pattern)
+			pattern = pattern[n:]
+		}
+
+		// escape ASCII punctuation only as escaped letters form sequences
+		// like \d and other escapes are invalid
+		if r < utf8.RuneSelf && (unicode.IsPunct(r) || unicode.IsSymbol(r)) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+		empty = false
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// testItem is an Item with static properties. Methods not used by Query
+// panic
+type testItem struct {
+	Item
+
+	path     dbus.ObjectPath
+	label    string
+	attrs    map[string]string
+	locked   bool
+	created  time.Time
+	modified time.Time
+}
+
+func (i *testItem) Path() dbus.ObjectPath                     { return i.path }
+func (i *testItem) GetLabel() (string, error)                 { return i.label, nil }
+func (i *testItem) GetAttributes() (map[string]string, error) { return i.attrs, nil }
+func (i *testItem) Locked() (bool, error)                     { return i.locked, nil }
+func (i *testItem) GetCreated() (time.Time, error)            { return i.created, nil }
+func (i *testItem) GetModified() (time.Time, error)           { return i.modified, nil }
+
+func TestQueryFilter(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2019, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	locked := true
+
+	items := []Item{
+		&testItem{
+			path:     "/1",
+			label:    "db password",
+			attrs:    map[string]string{"service": "db", "user": "app"},
+			created:  day(1),
+			modified: day(5),
+		},
+		&testItem{
+			path:     "/2",
+			label:    "api token",
+			attrs:    map[string]string{"service": "api", "env": "prod"},
+			locked:   true,
+			created:  day(2),
+			modified: day(3),
+		},
+		&testItem{
+			path:     "/3",
+			label:    "db admin",
+			attrs:    map[string]string{"service": "db", "user": "admin", "env": "dev"},
+			created:  day(3),
+			modified: day(4),
+		},
+	}
+
+	cases := []struct {
+		name     string
+		query    Query
+		expected []dbus.ObjectPath
+	}{
+		{
+			name:     "zero value",
+			expected: []dbus.ObjectPath{"/1", "/2", "/3"},
+		},
+		{
+			name:     "exact attributes",
+			query:    Query{Attributes: map[string]string{"service": "db"}},
+			expected: []dbus.ObjectPath{"/1", "/3"},
+		},
+		{
+			name:     "label glob",
+			query:    Query{Label: "db *"},
+			expected: []dbus.ObjectPath{"/1", "/3"},
+		},
+		{
+			name:     "label regexp",
+			query:    Query{LabelRegexp: regexp.MustCompile("token$")},
+			expected: []dbus.ObjectPath{"/2"},
+		},
+		{
+			name:     "attribute glob",
+			query:    Query{AttributeGlobs: map[string]string{"user": "a*"}},
+			expected: []dbus.ObjectPath{"/1", "/3"},
+		},
+		{
+			name:     "attribute regexp",
+			query:    Query{AttributeRegexps: map[string]*regexp.Regexp{"env": regexp.MustCompile("^p")}},
+			expected: []dbus.ObjectPath{"/2"},
+		},
+		{
+			name:     "has and missing attributes",
+			query:    Query{HasAttributes: []string{"env"}, MissingAttributes: []string{"user"}},
+			expected: []dbus.ObjectPath{"/2"},
+		},
+		{
+			name:     "created range",
+			query:    Query{CreatedAfter: day(2), CreatedBefore: day(3)},
+			expected: []dbus.ObjectPath{"/2", "/3"},
+		},
+		{
+			name:     "modified after",
+			query:    Query{ModifiedAfter: day(4)},
+			expected: []dbus.ObjectPath{"/1", "/3"},
+		},
+		{
+			name:     "locked",
+			query:    Query{Locked: &locked},
+			expected: []dbus.ObjectPath{"/2"},
+		},
+		{
+			name:     "sort by label",
+			query:    Query{SortBy: SortByLabel},
+			expected: []dbus.ObjectPath{"/2", "/3", "/1"},
+		},
+		{
+			name:     "sort by modified descending",
+			query:    Query{SortBy: SortByModified, Descending: true},
+			expected: []dbus.ObjectPath{"/1", "/3", "/2"},
+		},
+		{
+			name:     "limit after sort",
+			query:    Query{SortBy: SortByCreated, Descending: true, Limit: 2},
+			expected: []dbus.ObjectPath{"/3", "/2"},
+		},
+		{
+			name:  "no match",
+			query: Query{Attributes: map[string]string{"service": "mail"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := c.query.Filter(items)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var paths []dbus.ObjectPath
+			for _, i := range result {
+				paths = append(paths, i.Path())
+			}
+
+			if !reflect.DeepEqual(paths, c.expected) {
+				t.Errorf("expected %v but got %v", c.expected, paths)
+			}
+		})
+	}
+}
+
+func TestQueryFilterInvalidGlob(t *testing.T) {
+	items := []Item{&testItem{label: "db"}}
+
+	if _, err := (&Query{Label: "["}).Filter(items); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		s       string
+		match   bool
+	}{
+		{"Git: *", "Git: https://example.com/org/repo", true},
+		{"Git: https://*/repo", "Git: https://example.com/org/repo", true},
+		{"*", "a/b", true},
+		{"a?c", "a/c", true},
+		{"db *", "db password", true},
+		{"db *", "api token", false},
+		{"db", "db password", false},
+		{"[a-c]x", "bx", true},
+		{"[^a-c]x", "bx", false},
+		{"[!a]x", "!x", true},
+		{"[-a]", "-", true},
+		{"[a-]", "-", true},
+		{"[\\]]", "]", true},
+		{"[.$]", "$", true},
+		{"[ä ]", " ", true},
+		{"a.b", "axb", false},
+		{"\\*", "*", true},
+		{"\\*", "x", false},
+		{"(x|y)", "(x|y)", true},
+		{"ü*", "über/alles", true},
+	}
+
+	for _, c := range cases {
+		matched, err := globMatch(c.pattern, c.s)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.pattern, err)
+			continue
+		}
+
+		if matched != c.match {
+			t.Errorf("expected globMatch(%q, %q) to return %t", c.pattern, c.s, c.match)
+		}
+	}
+
+	for _, pattern := range []string{"[", "[]", "[a", "a\\", "[\\"} {
+		if _, err := globMatch(pattern, "a"); err == nil {
+			t.Errorf("expected an error for %q", pattern)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Recorder records the method calls and secret service signals exchanged
+// by a SecretService client. Secret values are redacted. Calls made using
+// Go are not recorded
+type Recorder struct {
+	l            sync.Mutex
+	interactions []Interaction
+	err          error
+}
+
+// NewRecorder returns a new Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// RecordSecretService returns a client to the SecretService on conn whose
+// DBus interactions are recorded by r
+func RecordSecretService(conn *dbus.Conn, r *Recorder) (SecretService, error) {
+	return newSecretService(newRecordingConn(conn, r))
+}
+
+// Fixture returns the interactions recorded so far
+func (r *Recorder) Fixture() *Fixture {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	return &Fixture{
+		Interactions: append([]Interaction(nil), r.interactions...),
+	}
+}
+
+// Err returns the first error encountered while recording an interaction
+func (r *Recorder) Err() error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	return r.err
+}
+
+// fail remembers err if it is the first error. It must be called with r.l
+// held
+func (r *Recorder) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// reserve reserves the slot for the next interaction so that signals
+// received while a call is pending are recorded after the call
+func (r *Recorder) reserve() int {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	r.interactions = append(r.interactions, Interaction{})
+	return len(r.interactions) - 1
+}
+
+// recordCall records call in the slot idx
+func (r *Recorder) recordCall(idx int, call *dbus.Call) {
+	i := Interaction{
+		Kind:        InteractionCall,
+		Destination: call.Destination,
+		Path:        call.Path,
+		Method:      call.Method,
+	}
+
+	args, err := encodeValues(call.Args)
+	if err == nil && call.Err == nil {
+		i.Result, err = encodeValues(call.Body)
+	}
+	i.Args = args
+
+	if call.Err != nil {
+		i.Error = &FixtureError{Message: call.Err.Error()}
+
+		if e, ok := call.Err.(dbus.Error); ok {
+			i.Error.Name = e.Name
+			i.Error.Message = ""
+			if len(e.Body) > 0 {
+				i.Error.Message, _ = e.Body[0].(string)
+			}
+		}
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if err != nil {
+		r.fail(fmt.Errorf("failed to record %s on %s: %s", call.Method, call.Path, err))
+	}
+
+	r.interactions[idx] = i
+}
+
+// recordSignal records s if it has been sent by the secret service
+func (r *Recorder) recordSignal(s *dbus.Signal) {
+	if !strings.HasPrefix(s.Name, SecretServicePrefix) {
+		return
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	body, err := encodeValues(s.Body)
+	if err != nil {
+		r.fail(fmt.Errorf("failed to record signal %s from %s: %s", s.Name, s.Path, err))
+	}
+
+	r.interactions = append(r.interactions, Interaction{
+		Kind:   InteractionSignal,
+		Path:   s.Path,
+		Method: s.Name,
+		Args:   body,
+	})
+}
+
+// recordingConn is a busConn that records calls and signals
+type recordingConn struct {
+	connWrapper
+	recorder *Recorder
+	signals  *signalHub
+}
+
+// newRecordingConn returns a recordingConn for conn that records to r
+func newRecordingConn(conn busConn, r *Recorder) *recordingConn {
+	return &recordingConn{
+		connWrapper: connWrapper{conn},
+		recorder:    r,
+		signals:     newSignalHub(conn, r.recordSignal),
+	}
+}
+
+// Object returns a handle to the object identified by dest and path whose
+// calls are recorded
+func (rc *recordingConn) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	o := &recordedObject{recorder: rc.recorder}
+	o.busObject = busObject{rc.busConn.Object(dest, path), o.CallWithContext}
+
+	return o
+}
+
+// Signal registers ch to receive all signals. Signals of the secret service
+// are recorded once before they are delivered to the registered channels
+func (rc *recordingConn) Signal(ch chan<- *dbus.Signal) {
+	rc.signals.add(ch)
+}
+
+// RemoveSignal removes ch from the channels registered using Signal
+func (rc *recordingConn) RemoveSignal(ch chan<- *dbus.Signal) {
+	rc.signals.remove(ch)
+}
+
+// recordedObject records calls and property accesses
+type recordedObject struct {
+	busObject
+	recorder *Recorder
+}
+
+// CallWithContext implements dbus.BusObject
+func (o *recordedObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	idx := o.recorder.reserve()
+	call := o.BusObject.CallWithContext(ctx, method, flags, args...)
+
+	// the call may not carry its destination and arguments if it has not
+	// been sent
+	recorded := *call
+	recorded.Destination = o.Destination()
+	recorded.Path = o.Path()
+	recorded.Method = method
+	recorded.Args = args
+	o.recorder.recordCall(idx, &recorded)
+
+	return call
+}
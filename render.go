@@ -0,0 +1,82 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// TemplateFuncs returns text/template functions that resolve secrets using svc:
+//
+//	{{ secret "service=db,user=app" }}
+//	{{ secret "secret-service://alias/default?service=db#label" }}
+//
+// The argument of secret is either a comma separated list of attributes or a
+// secret URI (see SecretURI). Locked items are unlocked as required and each
+// reference is only resolved once. The returned close function must be called
+// after rendering to close the session used to transfer the secrets
+func TemplateFuncs(ctx context.Context, svc SecretService) (template.FuncMap, func() error) {
+	var session Session
+	cache := make(map[string]string)
+
+	secret := func(ref string) (string, error) {
+		if value, ok := cache[ref]; ok {
+			return value, nil
+		}
+
+		var value []byte
+		if strings.HasPrefix(ref, URIScheme+":") {
+			s, err := Resolve(ctx, svc, ref)
+			if err != nil {
+				return "", err
+			}
+			value = s.Value.Bytes()
+		} else {
+			attrs, err := parseAttributeList(ref)
+			if err != nil {
+				return "", err
+			}
+
+			if session == nil {
+				if session, err = svc.OpenSession(); err != nil {
+					return "", err
+				}
+			}
+
+			if value, err = lookupAttributes(ctx, svc, session, attrs); err != nil {
+				return "", fmt.Errorf("%q: %s", ref, err)
+			}
+		}
+
+		cache[ref] = string(value)
+		return cache[ref], nil
+	}
+
+	closeFn := func() error {
+		if session == nil {
+			return nil
+		}
+		return session.Close()
+	}
+
+	return template.FuncMap{"secret": secret}, closeFn
+}
+
+// RenderTemplate parses the template text and executes it into w with the
+// functions returned by TemplateFuncs. Missing keys in data are reported as errors
+func RenderTemplate(ctx context.Context, svc SecretService, name, text string, data interface{}, w io.Writer) error {
+	funcs, closeFn := TemplateFuncs(ctx, svc)
+	defer closeFn()
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, data)
+}
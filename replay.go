@@ -0,0 +1,287 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Replayer replays the interactions of a Fixture without a DBus connection.
+// Each call is answered with the reply of the first recorded call that has
+// not been replayed yet and has the same destination, path, method and
+// arguments. Signals recorded after a call are delivered once the call has
+// been replayed
+type Replayer struct {
+	fixture *Fixture
+
+	l       sync.Mutex
+	used    []bool
+	err     error
+	signals map[chan<- *dbus.Signal]*signalTarget
+}
+
+// NewReplayer returns a Replayer for f
+func NewReplayer(f *Fixture) *Replayer {
+	return &Replayer{
+		fixture: f,
+		used:    make([]bool, len(f.Interactions)),
+		signals: make(map[chan<- *dbus.Signal]*signalTarget),
+	}
+}
+
+// ReplaySecretService returns a client to the SecretService that is served
+// by r
+func ReplaySecretService(r *Replayer) (SecretService, error) {
+	return newSecretService(&replayConn{r})
+}
+
+// Verify returns the first call that did not match the fixture or an error
+// if recorded calls have not been replayed
+func (r *Replayer) Verify() error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	for idx, i := range r.fixture.Interactions {
+		if i.Kind == InteractionCall && !r.used[idx] {
+			return fmt.Errorf("replay: call of %s on %s has not been replayed", i.Method, i.Path)
+		}
+	}
+
+	return nil
+}
+
+// replay returns the recorded reply for the call of method on path
+func (r *Replayer) replay(dest string, path dbus.ObjectPath, method string, args []interface{}) *dbus.Call {
+	call := &dbus.Call{
+		Destination: dest,
+		Path:        path,
+		Method:      method,
+		Args:        args,
+	}
+
+	encoded, err := encodeValues(args)
+	if err != nil {
+		call.Err = err
+		return call
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	idx := -1
+	for n, i := range r.fixture.Interactions {
+		if r.used[n] || i.Kind != InteractionCall {
+			continue
+		}
+
+		if i.Destination == dest && i.Path == path && i.Method == method && sameValues(i.Args, encoded) {
+			idx = n
+			break
+		}
+	}
+
+	if idx < 0 {
+		call.Err = fmt.Errorf("replay: unexpected call of %s on %s", method, path)
+		if r.err == nil {
+			r.err = call.Err
+		}
+		return call
+	}
+	r.used[idx] = true
+
+	i := r.fixture.Interactions[idx]
+	if i.Error != nil {
+		if i.Error.Name != "" {
+			call.Err = dbus.Error{
+				Name: i.Error.Name,
+				Body: []interface{}{i.Error.Message},
+			}
+		} else {
+			call.Err = errors.New(i.Error.Message)
+		}
+	} else if call.Body, err = decodeValues(i.Result); err != nil {
+		call.Err = err
+	}
+
+	var signals []*dbus.Signal
+	for n := idx + 1; n < len(r.fixture.Interactions); n++ {
+		s := r.fixture.Interactions[n]
+		if s.Kind != InteractionSignal || r.used[n] {
+			break
+		}
+		r.used[n] = true
+
+		body, err := decodeValues(s.Args)
+		if err != nil {
+			r.err = err
+			break
+		}
+
+		signals = append(signals, &dbus.Signal{
+			Sender: SecretServiceDest,
+			Path:   s.Path,
+			Name:   s.Method,
+			Body:   body,
+		})
+	}
+
+	if len(signals) > 0 {
+		for _, t := range r.signals {
+			t.push(signals...)
+		}
+	}
+
+	return call
+}
+
+// sameValues returns true if a and b hold the same values
+func sameValues(a, b []FixtureValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for idx := range a {
+		if a[idx].Signature != b[idx].Signature {
+			return false
+		}
+
+		var x, y bytes.Buffer
+		if json.Compact(&x, a[idx].Value) != nil || json.Compact(&y, b[idx].Value) != nil {
+			return false
+		}
+
+		if !bytes.Equal(x.Bytes(), y.Bytes()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// replayConn is a busConn served by a Replayer
+type replayConn struct {
+	r *Replayer
+}
+
+// Object returns a handle to the object identified by dest and path
+func (rc *replayConn) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	return &replayObject{
+		r:    rc.r,
+		dest: dest,
+		path: path,
+	}
+}
+
+// Signal registers ch to receive replayed signals
+func (rc *replayConn) Signal(ch chan<- *dbus.Signal) {
+	rc.r.l.Lock()
+	defer rc.r.l.Unlock()
+
+	if _, ok := rc.r.signals[ch]; !ok {
+		rc.r.signals[ch] = newSignalTarget(ch)
+	}
+}
+
+// RemoveSignal removes ch from the channels registered using Signal
+func (rc *replayConn) RemoveSignal(ch chan<- *dbus.Signal) {
+	rc.r.l.Lock()
+	t, ok := rc.r.signals[ch]
+	delete(rc.r.signals, ch)
+	rc.r.l.Unlock()
+
+	if ok {
+		t.stop()
+	}
+}
+
+// AddMatchSignal does nothing as all recorded signals are replayed
+func (rc *replayConn) AddMatchSignal(options ...dbus.MatchOption) error {
+	return nil
+}
+
+// RemoveMatchSignal does nothing as all recorded signals are replayed
+func (rc *replayConn) RemoveMatchSignal(options ...dbus.MatchOption) error {
+	return nil
+}
+
+// replayObject implements dbus.BusObject using a Replayer
+type replayObject struct {
+	r    *Replayer
+	dest string
+	path dbus.ObjectPath
+}
+
+// Call implements dbus.BusObject
+func (o *replayObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return o.CallWithContext(context.Background(), method, flags, args...)
+}
+
+// CallWithContext implements dbus.BusObject
+func (o *replayObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	if err := ctx.Err(); err != nil {
+		return &dbus.Call{Err: err}
+	}
+
+	return o.r.replay(o.dest, o.path, method, args)
+}
+
+// Go implements dbus.BusObject
+func (o *replayObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return o.GoWithContext(context.Background(), method, flags, ch, args...)
+}
+
+// GoWithContext implements dbus.BusObject. The call is replayed before
+// GoWithContext returns
+func (o *replayObject) GoWithContext(ctx context.Context, method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	if ch == nil {
+		ch = make(chan *dbus.Call, 1)
+	}
+
+	call := o.CallWithContext(ctx, method, flags, args...)
+	call.Done = ch
+	ch <- call
+
+	return call
+}
+
+// AddMatchSignal implements dbus.BusObject
+func (o *replayObject) AddMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+// RemoveMatchSignal implements dbus.BusObject
+func (o *replayObject) RemoveMatchSignal(iface, member string, options ...dbus.MatchOption) *dbus.Call {
+	return &dbus.Call{}
+}
+
+// GetProperty implements dbus.BusObject
+func (o *replayObject) GetProperty(p string) (dbus.Variant, error) {
+	return getProperty(o.CallWithContext, p)
+}
+
+// SetProperty implements dbus.BusObject
+func (o *replayObject) SetProperty(p string, v interface{}) error {
+	return setProperty(o.CallWithContext, p, v)
+}
+
+// Destination implements dbus.BusObject
+func (o *replayObject) Destination() string {
+	return o.dest
+}
+
+// Path implements dbus.BusObject
+func (o *replayObject) Path() dbus.ObjectPath {
+	return o.path
+}
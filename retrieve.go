@@ -0,0 +1,214 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// RetrieveOptions configures SecretService.SearchAndRetrieve
+type RetrieveOptions struct {
+	// Session is used to transfer the secrets. If nil, a new session
+	// is opened and closed before SearchAndRetrieve returns
+	Session Session
+
+	// Unlock unlocks all locked items found using a single call to
+	// Unlock. Any prompt that may be required is handled
+	Unlock bool
+
+	// SkipSecrets disables fetching the secret values
+	SkipSecrets bool
+}
+
+// SearchResult is a single item returned by SecretService.SearchAndRetrieve
+type SearchResult struct {
+	// Item is the client for the item
+	Item Item
+
+	// Path is the ObjectPath of the item
+	Path dbus.ObjectPath
+
+	// Collection is the ObjectPath of the collection that holds the item
+	Collection dbus.ObjectPath
+
+	// CollectionLabel is the label of the collection that holds the item
+	CollectionLabel string
+
+	// Label is the label of the item
+	Label string
+
+	// Attributes holds the attributes of the item
+	Attributes map[string]string
+
+	// Locked is true if the item is (still) locked
+	Locked bool
+
+	// Secret holds the secret of the item. It is nil if the item is
+	// locked or RetrieveOptions.SkipSecrets is set
+	Secret *Secret
+}
+
+// SearchAndRetrieve searches all collections for items matching attrs, optionally
+// unlocks them and fetches their secrets. Results are sorted by collection,
+// starting with the default collection, and by label
+func (svc *service) SearchAndRetrieve(ctx context.Context, attrs map[string]string, opts RetrieveOptions) ([]*SearchResult, error) {
+	call := svc.obj.CallWithContext(ctx, serviceMethodSearchItems, 0, attrs)
+	if call.Err != nil {
+		return nil, call.Err
+	}
+
+	var unlocked []dbus.ObjectPath
+	var locked []dbus.ObjectPath
+
+	if err := call.Store(&unlocked, &locked); err != nil {
+		return nil, err
+	}
+
+	if opts.Unlock && len(locked) > 0 {
+		paths, err := svc.unlockContext(ctx, locked)
+		if err != nil {
+			return nil, err
+		}
+
+		unlocked = append(unlocked, paths...)
+	}
+
+	isUnlocked := make(map[dbus.ObjectPath]bool, len(unlocked))
+	for _, p := range unlocked {
+		isUnlocked[p] = true
+	}
+
+	var secrets map[dbus.ObjectPath]*Secret
+	if !opts.SkipSecrets && len(unlocked) > 0 {
+		session := opts.Session
+		if session == nil {
+			var err error
+			session, err = svc.OpenSession()
+			if err != nil {
+				return nil, err
+			}
+			defer session.Close()
+		}
+
+		var err error
+		secrets, err = svc.getSecretsContext(ctx, unlocked, session.Path())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	collectionLabels := make(map[dbus.ObjectPath]string)
+	var results []*SearchResult
+
+	all := unlocked
+	for _, p := range locked {
+		if !isUnlocked[p] {
+			all = append(all, p)
+		}
+	}
+
+	for _, p := range all {
+		i, err := newItem(svc.conn, p)
+		if err != nil {
+			return nil, err
+		}
+
+		res := &SearchResult{
+			Item:       i,
+			Path:       p,
+			Collection: dbus.ObjectPath(path.Dir(string(p))),
+			Locked:     !isUnlocked[p],
+			Secret:     secrets[p],
+		}
+
+		if res.Label, err = i.GetLabel(); err != nil {
+			return nil, err
+		}
+
+		if res.Attributes, err = i.GetAttributes(); err != nil {
+			return nil, err
+		}
+
+		label, ok := collectionLabels[res.Collection]
+		if !ok {
+			col, err := newCollection(svc.conn, res.Collection)
+			if err != nil {
+				return nil, err
+			}
+
+			if label, err = col.GetLabel(); err != nil {
+				return nil, err
+			}
+			collectionLabels[res.Collection] = label
+		}
+		res.CollectionLabel = label
+
+		results = append(results, res)
+	}
+
+	// the order of collections depends on the provider so sort the results
+	// to make them deterministic. Items of the default collection come first
+	defaultPath, _ := svc.ReadAlias(DefaultAlias)
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+
+		if a.Collection != b.Collection {
+			if a.Collection == defaultPath {
+				return true
+			}
+			if b.Collection == defaultPath {
+				return false
+			}
+			return a.Collection < b.Collection
+		}
+
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+
+		return a.Path < b.Path
+	})
+
+	return results, nil
+}
+
+// unlockContext unlocks paths and waits for any prompt that may be required.
+// It returns the paths of all objects that have been unlocked
+func (svc *service) unlockContext(ctx context.Context, paths []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	call := svc.obj.CallWithContext(ctx, serviceMethodUnlock, 0, paths)
+	if call.Err != nil {
+		return nil, call.Err
+	}
+
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := call.Store(&unlocked, &prompt); err != nil {
+		return nil, err
+	}
+
+	if prompt != "/" {
+		result, err := runPrompt(ctx, svc.conn, prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		if result == nil {
+			return nil, ErrPromptDismissed
+		}
+
+		more, ok := result.Value().([]dbus.ObjectPath)
+		if !ok {
+			return nil, ErrInvalidType("[]ObjectPath", result.Value())
+		}
+
+		unlocked = append(unlocked, more...)
+	}
+
+	return unlocked, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"fmt"
+	"io"
+)
+
+// redacted is printed instead of the value of a SecretValue
+const redacted = "[REDACTED]"
+
+// SecretValue holds the value of a secret. It redacts the value when being
+// formatted using the fmt package or encoded as JSON so secrets do not leak into
+// logs or panic messages by accident. Use Reveal or Bytes to access the value
+type SecretValue []byte
+
+// Reveal returns the secret value as a string
+func (v SecretValue) Reveal() string {
+	return string(v)
+}
+
+// Bytes returns the secret value. The returned slice shares the backing
+// array with v so it is cleared by Wipe as well
+func (v SecretValue) Bytes() []byte {
+	return []byte(v)
+}
+
+// Wipe overwrites the backing array of the secret value with zeros
+func (v SecretValue) Wipe() {
+	for i := range v {
+		v[i] = 0
+	}
+}
+
+// String implements fmt.Stringer and returns a redacted placeholder
+func (v SecretValue) String() string {
+	return redacted
+}
+
+// GoString implements fmt.GoStringer and returns a redacted placeholder
+func (v SecretValue) GoString() string {
+	return "keyring.SecretValue(" + redacted + ")"
+}
+
+// Format implements fmt.Formatter and writes a redacted placeholder
+// for all verbs
+func (v SecretValue) Format(f fmt.State, verb rune) {
+	if verb == 'v' && f.Flag('#') {
+		io.WriteString(f, v.GoString())
+		return
+	}
+
+	io.WriteString(f, redacted)
+}
+
+// MarshalJSON implements json.Marshaler and encodes a redacted placeholder
+func (v SecretValue) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + redacted + `"`), nil
+}
+
+// MarshalText implements encoding.TextMarshaler and returns a redacted placeholder
+func (v SecretValue) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestSecretValueFormatting(t *testing.T) {
+	v := SecretValue("hunter2")
+
+	cases := []struct {
+		name     string
+		format   func() string
+		expected string
+	}{
+		{"%s", func() string { return fmt.Sprintf("%s", v) }, "[REDACTED]"},
+		{"%v", func() string { return fmt.Sprintf("%v", v) }, "[REDACTED]"},
+		{"%+v", func() string { return fmt.Sprintf("%+v", v) }, "[REDACTED]"},
+		{"%#v", func() string { return fmt.Sprintf("%#v", v) }, "keyring.SecretValue([REDACTED])"},
+		{"%q", func() string { return fmt.Sprintf("%q", v) }, "[REDACTED]"},
+		{"%x", func() string { return fmt.Sprintf("%x", v) }, "[REDACTED]"},
+		{"%d", func() string { return fmt.Sprintf("%d", v) }, "[REDACTED]"},
+		{"Println", func() string { return fmt.Sprintln(v) }, "[REDACTED]\n"},
+		{"struct", func() string { return fmt.Sprintf("%+v", Secret{Value: v}) }, "{Session: Parameters:[] Value:[REDACTED] ContentType: buf:<nil>}"},
+		{"error", func() string { return fmt.Errorf("failed with %v", v).Error() }, "failed with [REDACTED]"},
+		{"json", func() string {
+			blob, err := json.Marshal(struct{ Value SecretValue }{v})
+			if err != nil {
+				return err.Error()
+			}
+			return string(blob)
+		}, `{"Value":"[REDACTED]"}`},
+		{"json map value", func() string {
+			blob, err := json.Marshal(map[string]SecretValue{"k": v})
+			if err != nil {
+				return err.Error()
+			}
+			return string(blob)
+		}, `{"k":"[REDACTED]"}`},
+		{"Reveal", func() string { return v.Reveal() }, "hunter2"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if s := c.format(); s != c.expected {
+				t.Errorf("expected %q but got %q", c.expected, s)
+			}
+		})
+	}
+}
+
+func TestSecretValueWipe(t *testing.T) {
+	v := SecretValue("hunter2")
+	b := v.Bytes()
+
+	v.Wipe()
+
+	for _, c := range b {
+		if c != 0 {
+			t.Fatalf("expected the backing array to be wiped but got %q", b)
+		}
+	}
+
+	if len(v) != len("hunter2") {
+		t.Errorf("expected Wipe to keep the length but got %d", len(v))
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"unsafe"
+)
+
+// ErrSecureMemoryUnsupported is returned by CheckSecureMemory and
+// Secret.LockErr on platforms that cannot lock memory into RAM
+var ErrSecureMemoryUnsupported = errors.New("locking memory is not supported on this platform")
+
+// errNotHardened is returned by Secret.LockErr for secrets that are not held
+// in secure memory
+var errNotHardened = errors.New("secret is not held in secure memory")
+
+// CheckSecureMemory checks if secrets can be locked into RAM and excluded
+// from core dumps by locking a single page. It returns the error of the
+// platform, for example if RLIMIT_MEMLOCK is exhausted. Retrieved secrets are
+// still returned if locking fails (see Secret.LockErr)
+func CheckSecureMemory() error {
+	buf := newSecureBuffer([]byte{0})
+	defer buf.release()
+
+	return buf.err
+}
+
+// lockPages locks the pages of new secure buffers. Tests replace it to
+// simulate platforms where locking fails
+var lockPages = lockMemory
+
+// secureBuffer holds secret bytes in memory that is locked into RAM and
+// excluded from core dumps where supported by the platform. The memory is
+// wiped when the buffer is released or, as a safety net, when it becomes
+// unreachable
+type secureBuffer struct {
+	// raw is the underlying allocation. It is larger than data so data
+	// can be aligned to page boundaries as required by mlock and madvise
+	raw []byte
+
+	// pages are the page aligned bytes of raw that are locked
+	pages []byte
+
+	// data holds the secret and is a prefix of pages
+	data []byte
+
+	// err is the error encountered while locking pages, if any
+	err error
+}
+
+// newSecureBuffer returns a secure buffer that holds a copy of b
+func newSecureBuffer(b []byte) *secureBuffer {
+	pageSize := os.Getpagesize()
+	size := (len(b) + pageSize - 1) / pageSize * pageSize
+	total := size + pageSize
+
+	raw := make([]byte, total)
+
+	offset := 0
+	if rem := int(uintptr(unsafe.Pointer(&raw[0])) % uintptr(pageSize)); rem != 0 {
+		offset = pageSize - rem
+	}
+
+	buf := &secureBuffer{
+		raw:   raw,
+		pages: raw[offset : offset+size],
+	}
+	buf.data = buf.pages[:len(b)]
+	copy(buf.data, b)
+
+	// locking is best-effort as it may fail if RLIMIT_MEMLOCK is exceeded.
+	// The error is reported by Secret.LockErr
+	buf.err = lockPages(buf.pages)
+
+	// The finalizer is attached to the allocation itself as it is kept alive
+	// by any slice of data. It must not reference raw or buf as this would
+	// prevent the allocation from ever becoming unreachable
+	runtime.SetFinalizer(&raw[0], func(p *byte) {
+		raw := (*[1 << 30]byte)(unsafe.Pointer(p))[:total:total]
+		wipeMemory(raw[offset : offset+size])
+	})
+
+	return buf
+}
+
+// release wipes the buffer, unlocks its memory and removes the finalizer
+func (buf *secureBuffer) release() {
+	wipeMemory(buf.pages)
+	runtime.SetFinalizer(&buf.raw[0], nil)
+}
+
+// wipeMemory overwrites b with zeros and unlocks it
+func wipeMemory(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	unlockMemory(b)
+}
+
+// harden moves the value of s into a secure buffer and wipes the
+// original value
+func (s *Secret) harden() {
+	if len(s.Value) == 0 {
+		return
+	}
+
+	buf := newSecureBuffer(s.Value)
+	s.Value.Wipe()
+
+	s.buf = buf
+	s.Value = SecretValue(buf.data)
+}
+
+// LockErr returns the error encountered while locking the memory holding the
+// secret into RAM and excluding it from core dumps. It returns nil if the
+// memory is locked. Only secrets returned by Item.GetSecret and
+// SecretService.GetSecrets are held in secure memory
+func (s *Secret) LockErr() error {
+	if s.buf == nil {
+		return errNotHardened
+	}
+
+	return s.buf.err
+}
+
+// Release wipes the secret value and frees the secure memory holding it.
+// The secret must not be used afterwards. Secrets returned by Item.GetSecret
+// and SecretService.GetSecrets are kept in memory that is locked into RAM and
+// excluded from core dumps (where supported) and are wiped by a finalizer if
+// Release is not called
+func (s *Secret) Release() {
+	if s.buf != nil {
+		s.buf.release()
+		s.buf = nil
+	} else {
+		s.Value.Wipe()
+	}
+
+	s.Value = nil
+}
@@ -0,0 +1,28 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import "syscall"
+
+// madvise advices not exported by package syscall
+const (
+	madvDontDump = 0x10
+	madvDoDump   = 0x11
+)
+
+// lockMemory locks the page aligned memory b into RAM and
+// excludes it from core dumps
+func lockMemory(b []byte) error {
+	if err := syscall.Madvise(b, madvDontDump); err != nil {
+		return err
+	}
+
+	return syscall.Mlock(b)
+}
+
+// unlockMemory reverts lockMemory
+func unlockMemory(b []byte) {
+	_ = syscall.Munlock(b)
+	_ = syscall.Madvise(b, madvDoDump)
+}
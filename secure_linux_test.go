@@ -0,0 +1,41 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"syscall"
+	"testing"
+)
+
+// rlimitMemlock is RLIMIT_MEMLOCK which is not exported by package syscall
+const rlimitMemlock = 8
+
+func TestSecureMemoryRlimit(t *testing.T) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(rlimitMemlock, &limit); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Setrlimit(rlimitMemlock, &limit)
+
+	if err := syscall.Setrlimit(rlimitMemlock, &syscall.Rlimit{Cur: 0, Max: limit.Max}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSecureMemory(); err == nil {
+		// processes with CAP_IPC_LOCK are not restricted by the limit
+		t.Skip("memory can be locked despite RLIMIT_MEMLOCK of 0")
+	}
+
+	s := &Secret{Value: SecretValue("hunter2")}
+	s.harden()
+	defer s.Release()
+
+	if s.LockErr() == nil {
+		t.Errorf("expected LockErr to report the exceeded limit")
+	}
+
+	if s.Value.Reveal() != "hunter2" {
+		t.Errorf("expected the secret to be usable if locking fails")
+	}
+}
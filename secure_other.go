@@ -0,0 +1,16 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+//go:build !linux
+// +build !linux
+
+package keyring
+
+// lockMemory is not supported on this platform. Secrets are still
+// wiped on release
+func lockMemory(b []byte) error {
+	return ErrSecureMemoryUnsupported
+}
+
+// unlockMemory is not supported on this platform
+func unlockMemory(b []byte) {}
@@ -0,0 +1,86 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"errors"
+	"testing"
+)
+
+// zeroed returns true if all bytes of b are zero
+func zeroed(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestSecretReleaseWipesSecureMemory(t *testing.T) {
+	original := []byte("hunter2")
+	s := &Secret{Value: SecretValue(original)}
+	s.harden()
+
+	if s.buf == nil {
+		t.Fatal("expected the secret to be held in secure memory")
+	}
+
+	if !zeroed(original) {
+		t.Errorf("expected the original value to be wiped")
+	}
+
+	if s.Value.Reveal() != "hunter2" {
+		t.Errorf("unexpected value after hardening")
+	}
+
+	pages := s.buf.pages
+	s.Release()
+
+	if !zeroed(pages) {
+		t.Errorf("expected the secure memory to be zeroed")
+	}
+
+	if s.Value != nil {
+		t.Errorf("expected the value to be reset")
+	}
+}
+
+func TestSecretLockFailure(t *testing.T) {
+	errLock := errors.New("cannot allocate memory")
+
+	defer func(fn func([]byte) error) { lockPages = fn }(lockPages)
+	lockPages = func([]byte) error { return errLock }
+
+	s := &Secret{Value: SecretValue("hunter2")}
+	s.harden()
+
+	if err := s.LockErr(); err != errLock {
+		t.Errorf("expected LockErr to report %v but got %v", errLock, err)
+	}
+
+	if s.Value.Reveal() != "hunter2" {
+		t.Errorf("expected the secret to be usable if locking fails")
+	}
+
+	pages := s.buf.pages
+	s.Release()
+
+	if !zeroed(pages) {
+		t.Errorf("expected the memory to be zeroed if locking failed")
+	}
+
+	if err := CheckSecureMemory(); err != errLock {
+		t.Errorf("expected CheckSecureMemory to report %v but got %v", errLock, err)
+	}
+}
+
+func TestSecretNotHardened(t *testing.T) {
+	s := &Secret{Value: SecretValue("hunter2")}
+
+	if err := s.LockErr(); err != errNotHardened {
+		t.Errorf("expected %v but got %v", errNotHardened, err)
+	}
+}
@@ -4,7 +4,9 @@
 package keyring
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"github.com/godbus/dbus/v5"
 )
@@ -42,6 +44,12 @@ type SecretService interface {
 	// GetCollection returns the collection with the given name
 	GetCollection(name string) (Collection, error)
 
+	// GetCollectionByPath returns the collection with the given object path
+	GetCollectionByPath(path dbus.ObjectPath) (Collection, error)
+
+	// GetItemByPath returns the item with the given object path
+	GetItemByPath(path dbus.ObjectPath) (Item, error)
+
 	// GetAllCollections returns all collections stored in the secret service
 	GetAllCollections() ([]Collection, error)
 
@@ -53,9 +61,18 @@ type SecretService interface {
 	// in the unlocked or locked slice
 	SearchItems(map[string]string) (unlocked []Item, locked []Item, err error)
 
+	// Query searches for items in all collections that match q. The exact
+	// attribute matches of q are passed to SearchItems
+	Query(q *Query) ([]Item, error)
+
 	// GetSecrets returns multiple secrets from different items
 	GetSecrets(paths []dbus.ObjectPath, session dbus.ObjectPath) (map[dbus.ObjectPath]*Secret, error)
 
+	// SearchAndRetrieve searches all collections for items matching attrs, optionally
+	// unlocks them and fetches their secrets. Results are sorted by collection,
+	// starting with the default collection, and by label
+	SearchAndRetrieve(ctx context.Context, attrs map[string]string, opts RetrieveOptions) ([]*SearchResult, error)
+
 	// ReadAlias resolves the alias (like 'default') to the object path of the
 	// referenced collection
 	ReadAlias(name string) (dbus.ObjectPath, error)
@@ -68,6 +85,19 @@ type SecretService interface {
 	// RemoveAlias removes the provided alias. This is a utility method for SetAlias(name, "/")
 	RemoveAlias(name string) error
 
+	// ListAliases returns all aliases and the path of the collection they reference.
+	// Aliases are discovered by introspecting AliasesPath which is not supported
+	// by all providers
+	ListAliases() (map[string]dbus.ObjectPath, error)
+
+	// GetCollectionByAlias returns the collection referenced by the alias
+	GetCollectionByAlias(name string) (Collection, error)
+
+	// EnsureDefaultCollection returns the default collection. If the default alias
+	// is not set it is assigned to the collection labeled DefaultCollectionLabel
+	// which is created if required
+	EnsureDefaultCollection() (Collection, error)
+
 	// CreateCollection creates a new collection with the given properties and an optional alias (leave empty for no alias)
 	// It also handles any prompt that may be required
 	CreateCollection(label string, alias string) (Collection, error)
@@ -77,16 +107,30 @@ type SecretService interface {
 
 	// Unlock unlocks items or collections and handles any prompt that may be required
 	Unlock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, error)
+
+	// Capabilities returns the capabilities of the secret service provider
+	// (see DetectProvider). The result is cached until another application
+	// owns the service name. Once detected, aliases are not used if the
+	// provider does not support them
+	Capabilities() (*Capabilities, error)
 }
 
 type service struct {
 	obj  dbus.BusObject
-	conn *dbus.Conn
+	conn busConn
+
+	capsLock sync.Mutex
+	caps     *Capabilities
 }
 
 // GetSecretService returns a client to the SecretService (org.freedesktop.secrets)
 // on the provided DBus connection
 func GetSecretService(conn *dbus.Conn) (SecretService, error) {
+	return newSecretService(conn)
+}
+
+// newSecretService returns a client to the SecretService on conn
+func newSecretService(conn busConn) (SecretService, error) {
 	obj := conn.Object(SecretServiceDest, SecretServicePath)
 
 	svc := &service{
@@ -110,7 +154,7 @@ func (svc *service) OpenSession() (Session, error) {
 
 	path, ok := call.Body[1].(dbus.ObjectPath)
 	if ok {
-		return GetSession(svc.conn, path)
+		return newSession(svc.conn, path)
 	}
 
 	return nil, ErrInvalidType("ObjectPath", call.Body[0])
@@ -133,7 +177,17 @@ func (svc *service) GetCollection(name string) (Collection, error) {
 			return c, nil
 		}
 	}
-	return nil, fmt.Errorf("unknown collection")
+	return nil, ErrUnknownCollection
+}
+
+// GetCollectionByPath returns the collection with the given object path
+func (svc *service) GetCollectionByPath(path dbus.ObjectPath) (Collection, error) {
+	return newCollection(svc.conn, path)
+}
+
+// GetItemByPath returns the item with the given object path
+func (svc *service) GetItemByPath(path dbus.ObjectPath) (Item, error) {
+	return newItem(svc.conn, path)
 }
 
 // GetAllCollections returns all collections stored in the secret service
@@ -151,7 +205,7 @@ func (svc *service) GetAllCollections() ([]Collection, error) {
 	col := make([]Collection, len(paths))
 	for i, p := range paths {
 		var err error
-		col[i], err = GetCollection(svc.conn, p)
+		col[i], err = newCollection(svc.conn, p)
 
 		if err != nil {
 			return nil, err
@@ -164,7 +218,49 @@ func (svc *service) GetAllCollections() ([]Collection, error) {
 // GetDefaultCollection returns the default collection of the secret service
 // ( DBus path = /org/freedesktop/secrets/aliases/default )
 func (svc *service) GetDefaultCollection() (Collection, error) {
-	return GetCollection(svc.conn, DefaultCollection)
+	// not all providers export the alias path so prefer ReadAlias
+	// and fall back to DefaultCollection
+	path := dbus.ObjectPath(DefaultCollection)
+	if svc.supportsAliases() {
+		if p, err := svc.ReadAlias(DefaultAlias); err == nil {
+			path = p
+		}
+	}
+
+	return newCollection(svc.conn, path)
+}
+
+// Capabilities returns the capabilities of the secret service provider
+func (svc *service) Capabilities() (*Capabilities, error) {
+	svc.capsLock.Lock()
+	defer svc.capsLock.Unlock()
+
+	if svc.caps != nil {
+		var owner string
+		err := svc.conn.Object(busDest, busPath).Call(busMethodGetNameOwner, 0, SecretServiceDest).Store(&owner)
+		if err == nil && owner == svc.caps.Owner {
+			return svc.caps, nil
+		}
+	}
+
+	svc.caps = nil
+
+	caps, err := detectProvider(svc.conn)
+	if err != nil {
+		return nil, err
+	}
+	svc.caps = caps
+
+	return svc.caps, nil
+}
+
+// supportsAliases returns false if Capabilities reported that the provider
+// does not support aliases. The provider is never detected implicitly
+func (svc *service) supportsAliases() bool {
+	svc.capsLock.Lock()
+	defer svc.capsLock.Unlock()
+
+	return svc.caps == nil || svc.caps.Aliases
 }
 
 // SearchItems finds all items in any collection and returns them either
@@ -190,7 +286,7 @@ func (svc *service) SearchItems(attrs map[string]string) ([]Item, []Item, error)
 	lockedItems := make([]Item, len(locked))
 
 	for i, u := range unlocked {
-		item, err := GetItem(svc.conn, u)
+		item, err := newItem(svc.conn, u)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -198,7 +294,7 @@ func (svc *service) SearchItems(attrs map[string]string) ([]Item, []Item, error)
 	}
 
 	for i, u := range locked {
-		item, err := GetItem(svc.conn, u)
+		item, err := newItem(svc.conn, u)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -208,9 +304,45 @@ func (svc *service) SearchItems(attrs map[string]string) ([]Item, []Item, error)
 	return unlockedItems, lockedItems, nil
 }
 
+// Query searches for items in all collections that match q. The exact
+// attribute matches of q are passed to SearchItems
+func (svc *service) Query(q *Query) ([]Item, error) {
+	var items []Item
+
+	if len(q.Attributes) > 0 {
+		unlocked, locked, err := svc.SearchItems(q.Attributes)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(unlocked, locked...)
+	} else {
+		collections, err := svc.GetAllCollections()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range collections {
+			all, err := c.GetAllItems()
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, all...)
+		}
+	}
+
+	return q.Filter(items)
+}
+
 // GetSecrets returns multiple secrets from different items
 func (svc *service) GetSecrets(paths []dbus.ObjectPath, session dbus.ObjectPath) (map[dbus.ObjectPath]*Secret, error) {
-	call := svc.obj.Call(serviceMethodGetSecrets, 0, paths, session)
+	return svc.getSecretsContext(context.Background(), paths, session)
+}
+
+// getSecretsContext is like GetSecrets but uses ctx for the method call
+func (svc *service) getSecretsContext(ctx context.Context, paths []dbus.ObjectPath, session dbus.ObjectPath) (map[dbus.ObjectPath]*Secret, error) {
+	call := svc.obj.CallWithContext(ctx, serviceMethodGetSecrets, 0, paths, session)
 	if call.Err != nil {
 		return nil, call.Err
 	}
@@ -229,6 +361,8 @@ func (svc *service) GetSecrets(paths []dbus.ObjectPath, session dbus.ObjectPath)
 			return nil, err
 		}
 
+		sec.harden()
+
 		secrets[path] = &sec
 	}
 
@@ -249,7 +383,7 @@ func (svc *service) ReadAlias(name string) (dbus.ObjectPath, error) {
 	}
 
 	if path == dbus.ObjectPath("/") {
-		return path, fmt.Errorf("unknown alias")
+		return path, ErrUnknownAlias
 	}
 
 	return path, nil
@@ -290,7 +424,7 @@ func (svc *service) CreateCollection(label string, alias string) (Collection, er
 	if promptPath != "/" {
 		// assert(collectionPath == "")
 
-		p := GetPrompt(svc.conn, promptPath)
+		p := newPrompt(svc.conn, promptPath)
 		res, err := p.Prompt("")
 		if err != nil {
 			return nil, err
@@ -298,7 +432,7 @@ func (svc *service) CreateCollection(label string, alias string) (Collection, er
 
 		result := <-res
 		if result == nil {
-			return nil, fmt.Errorf("prompt dismissed")
+			return nil, ErrPromptDismissed
 		}
 
 		var ok bool
@@ -308,7 +442,7 @@ func (svc *service) CreateCollection(label string, alias string) (Collection, er
 		}
 	}
 
-	col, err := GetCollection(svc.conn, collectionPath)
+	col, err := newCollection(svc.conn, collectionPath)
 	if err != nil {
 		return nil, err
 	}
@@ -330,7 +464,7 @@ func (svc *service) Lock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
 	}
 
 	if prompt != "/" {
-		p := GetPrompt(svc.conn, prompt)
+		p := newPrompt(svc.conn, prompt)
 		res, err := p.Prompt("")
 		if err != nil {
 			return nil, err
@@ -338,7 +472,12 @@ func (svc *service) Lock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
 
 		result := <-res
 		if result == nil {
-			return locked, fmt.Errorf("prompt dismissed")
+			return locked, ErrPromptDismissed
+		}
+
+		// the prompt result holds the objects handled by the prompt
+		if paths, ok := result.Value().([]dbus.ObjectPath); ok {
+			locked = append(locked, paths...)
 		}
 	}
 
@@ -359,7 +498,7 @@ func (svc *service) Unlock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
 	}
 
 	if prompt != "/" {
-		p := GetPrompt(svc.conn, prompt)
+		p := newPrompt(svc.conn, prompt)
 		res, err := p.Prompt("")
 		if err != nil {
 			return nil, err
@@ -367,7 +506,12 @@ func (svc *service) Unlock(paths []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
 
 		result := <-res
 		if result == nil {
-			return locked, fmt.Errorf("prompt dismissed")
+			return locked, ErrPromptDismissed
+		}
+
+		// the prompt result holds the objects handled by the prompt
+		if paths, ok := result.Value().([]dbus.ObjectPath); ok {
+			locked = append(locked, paths...)
 		}
 	}
 
@@ -4,6 +4,8 @@
 package keyring
 
 import (
+	"sync"
+
 	"github.com/godbus/dbus/v5"
 )
 
@@ -25,26 +27,96 @@ type Session interface {
 // GetSession returns a new Session for the provided path. Note that session must be opened beforehand
 // Use SecretService.OpenSession() to open a new session and return a Session client
 func GetSession(conn *dbus.Conn, path dbus.ObjectPath) (Session, error) {
+	return newSession(conn, path)
+}
+
+// newSession returns a new Session for the provided path on conn
+func newSession(conn busConn, path dbus.ObjectPath) (Session, error) {
 	obj := conn.Object(SecretServiceDest, dbus.ObjectPath(path))
 
-	return &session{
+	s := &session{
+		conn: conn,
 		path: path,
 		obj:  obj,
-	}, nil
+	}
+
+	if t, ok := conn.(sessionTracker); ok {
+		t.trackSession(s)
+	}
+
+	return s, nil
 }
 
 // session implements the Session interface
 type session struct {
+	conn busConn
+
+	l    sync.Mutex
 	path dbus.ObjectPath
 	obj  dbus.BusObject
+
+	// stale is set if the session could not be re-opened after the provider
+	// has been restarted
+	stale error
 }
 
 // Path returns the ObjectPath of the session
 func (s *session) Path() dbus.ObjectPath {
+	s.l.Lock()
+	defer s.l.Unlock()
+
 	return s.path
 }
 
-// Close closes the session
+// Close closes the session. It returns a *StaleHandleError if the session
+// could not be re-opened after the provider has been restarted
 func (s *session) Close() error {
-	return s.obj.Call(sessionMethodClose, 0).Err
+	if t, ok := s.conn.(sessionTracker); ok {
+		t.untrackSession(s)
+	}
+
+	s.l.Lock()
+	obj, stale := s.obj, s.stale
+	s.l.Unlock()
+
+	if stale != nil {
+		return stale
+	}
+
+	return obj.Call(sessionMethodClose, 0).Err
+}
+
+// markStale marks s as stale because it could not be re-opened
+func (s *session) markStale(err error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.stale = &StaleHandleError{
+		Path: s.path,
+		Err:  err,
+	}
+}
+
+// reopen opens a new session on conn and replaces the path of s. It is used
+// to restore sessions after the connection to the bus has been re-established
+// or the provider has been restarted
+func (s *session) reopen(conn busConn) error {
+	var output dbus.Variant
+	var path dbus.ObjectPath
+
+	err := conn.Object(SecretServiceDest, SecretServicePath).
+		Call(serviceMethodOpenSession, 0, AlgPlain, dbus.MakeVariant("")).
+		Store(&output, &path)
+	if err != nil {
+		return err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.path = path
+	s.obj = s.conn.Object(SecretServiceDest, path)
+	s.stale = nil
+
+	return nil
 }
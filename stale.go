@@ -0,0 +1,256 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busErrorUnknownObject    = busDest + ".Error.UnknownObject"
+	busErrorUnknownInterface = busDest + ".Error.UnknownInterface"
+)
+
+// StaleHandleError is returned when calling an object that no longer exists
+// because the secret service provider has been restarted since the handle
+// was created
+type StaleHandleError struct {
+	// Path is the object path of the stale handle
+	Path dbus.ObjectPath
+
+	// Err is the error returned by the provider
+	Err error
+}
+
+// Error implements the error interface
+func (e *StaleHandleError) Error() string {
+	return fmt.Sprintf("stale handle %s: the secret service has been restarted: %s", e.Path, e.Err)
+}
+
+// IsStale returns true if err is a *StaleHandleError
+func IsStale(err error) bool {
+	_, ok := err.(*StaleHandleError)
+	return ok
+}
+
+// nameOwnerChangedMatch returns the match rule for owner changes of
+// SecretServiceDest
+func nameOwnerChangedMatch() []dbus.MatchOption {
+	return []dbus.MatchOption{
+		dbus.WithMatchSender(busDest),
+		dbus.WithMatchInterface(busDest),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchOption("arg0", SecretServiceDest),
+	}
+}
+
+// parseNameOwnerChanged returns the new owner of SecretServiceDest if s is
+// a NameOwnerChanged signal for it
+func parseNameOwnerChanged(s *dbus.Signal) (string, bool) {
+	if s.Name != busSignalNameOwnerChanged || len(s.Body) != 3 {
+		return "", false
+	}
+
+	name, _ := s.Body[0].(string)
+	owner, ok := s.Body[2].(string)
+	if name != SecretServiceDest || !ok {
+		return "", false
+	}
+
+	return owner, true
+}
+
+// WatchSecretService returns a client to the SecretService on conn that
+// detects restarts of the provider until ctx is cancelled. Sessions opened
+// through the client are re-opened after a restart and calls on handles to
+// objects that vanished with the restart return a *StaleHandleError
+func WatchSecretService(ctx context.Context, conn *dbus.Conn) (SecretService, error) {
+	w, err := newProviderWatcher(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSecretService(w)
+}
+
+// providerWatcher is a busConn that tracks the owner of SecretServiceDest
+type providerWatcher struct {
+	connWrapper
+
+	l          sync.Mutex
+	owner      string
+	generation uint64
+	sessions   map[*session]struct{}
+}
+
+// newProviderWatcher returns a providerWatcher for conn that stops watching
+// once ctx is cancelled
+func newProviderWatcher(ctx context.Context, conn busConn) (*providerWatcher, error) {
+	w := &providerWatcher{
+		connWrapper: connWrapper{conn},
+		sessions:    make(map[*session]struct{}),
+	}
+
+	match := nameOwnerChangedMatch()
+	if err := conn.AddMatchSignal(match...); err != nil {
+		return nil, err
+	}
+
+	sig := make(chan *dbus.Signal, 10)
+	conn.Signal(sig)
+
+	err := conn.Object(busDest, busPath).Call(busMethodGetNameOwner, 0, SecretServiceDest).Store(&w.owner)
+	if err != nil && !isDBusError(err, busErrorNameHasNoOwner) {
+		conn.RemoveSignal(sig)
+		conn.RemoveMatchSignal(match...)
+		return nil, err
+	}
+
+	go func() {
+		defer conn.RemoveMatchSignal(match...)
+		defer conn.RemoveSignal(sig)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s, ok := <-sig:
+				if !ok {
+					return
+				}
+
+				if owner, ok := parseNameOwnerChanged(s); ok {
+					w.ownerChanged(owner)
+				}
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// ownerChanged invalidates all handles and re-opens the sessions once the
+// provider is available again
+func (w *providerWatcher) ownerChanged(owner string) {
+	w.l.Lock()
+	if owner == w.owner {
+		w.l.Unlock()
+		return
+	}
+
+	w.owner = owner
+	w.generation++
+
+	sessions := make([]*session, 0, len(w.sessions))
+	for s := range w.sessions {
+		sessions = append(sessions, s)
+	}
+	w.l.Unlock()
+
+	if owner == "" {
+		return
+	}
+
+	for _, s := range sessions {
+		if err := s.reopen(w.busConn); err != nil {
+			s.markStale(err)
+		}
+	}
+}
+
+// currentGeneration returns the number of owner changes seen so far
+func (w *providerWatcher) currentGeneration() uint64 {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	return w.generation
+}
+
+// Object returns the object identified by dest and path. Handles to objects of
+// the secret service are marked stale when the provider is restarted
+func (w *providerWatcher) Object(dest string, path dbus.ObjectPath) dbus.BusObject {
+	obj := w.busConn.Object(dest, path)
+	if dest != SecretServiceDest || path == SecretServicePath {
+		return obj
+	}
+
+	o := &watchedObject{
+		watcher:    w,
+		generation: w.currentGeneration(),
+	}
+	o.busObject = busObject{obj, o.CallWithContext}
+
+	return o
+}
+
+// trackSession implements sessionTracker
+func (w *providerWatcher) trackSession(s *session) {
+	w.l.Lock()
+	w.sessions[s] = struct{}{}
+	w.l.Unlock()
+
+	w.connWrapper.trackSession(s)
+}
+
+// untrackSession implements sessionTracker
+func (w *providerWatcher) untrackSession(s *session) {
+	w.l.Lock()
+	delete(w.sessions, s)
+	w.l.Unlock()
+
+	w.connWrapper.untrackSession(s)
+}
+
+// watchedObject is a handle to an object of the secret service that may
+// become stale when the provider is restarted
+type watchedObject struct {
+	busObject
+	watcher *providerWatcher
+
+	// generation of the watcher when the handle was created or last used
+	// successfully. Accessed atomically
+	generation uint64
+}
+
+// CallWithContext implements dbus.BusObject. If the provider has been
+// restarted since the handle was created, errors indicating a missing object
+// are returned as *StaleHandleError
+func (o *watchedObject) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	current := o.watcher.currentGeneration()
+	call := o.BusObject.CallWithContext(ctx, method, flags, args...)
+
+	if atomic.LoadUint64(&o.generation) == current {
+		return call
+	}
+
+	if call.Err == nil {
+		// the object survived the restart
+		atomic.StoreUint64(&o.generation, current)
+		return call
+	}
+
+	if isMissingObject(call.Err) {
+		call.Err = &StaleHandleError{
+			Path: o.Path(),
+			Err:  call.Err,
+		}
+	}
+
+	return call
+}
+
+// isMissingObject returns true if err indicates that the called object
+// does not exist
+func isMissingObject(err error) bool {
+	return isDBusError(err, busErrorUnknownObject) ||
+		isDBusError(err, busErrorUnknownMethod) ||
+		isDBusError(err, busErrorUnknownInterface) ||
+		isDBusError(err, ErrorNoSuchObject) ||
+		isDBusError(err, ErrorNoSession)
+}
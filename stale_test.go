@@ -0,0 +1,96 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring_test
+
+import (
+	"testing"
+	"time"
+
+	keyring "github.com/ppacher/go-dbus-keyring"
+	"github.com/ppacher/go-dbus-keyring/keyringfake"
+)
+
+func TestWatchProviderRestart(t *testing.T) {
+	fake := keyringfake.New()
+	bus := startBus(t, nil)
+	defer bus.Close()
+
+	provider := serve(t, bus, fake)
+
+	client, err := keyring.Connect(keyring.ConnectOptions{
+		Address:       bus.Address,
+		WatchProvider: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	svc, err := client.SecretService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	col, err := svc.GetDefaultCollection()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept, err := col.CreateItem(session.Path(), "kept", map[string]string{"service": "kept"}, keyring.SecretValue("hunter2"), "text/plain", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vanished, err := col.CreateItem(session.Path(), "vanished", map[string]string{"service": "vanished"}, keyring.SecretValue("x"), "text/plain", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the provider exits and loses the item before it is started again
+	before := session.Path()
+	provider.Close()
+
+	unlocked, _, err := fake.SearchItems(map[string]string{"service": "vanished"})
+	if err != nil || len(unlocked) != 1 {
+		t.Fatalf("failed to find the item in the fake: %v", err)
+	}
+
+	if err := unlocked[0].Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	provider = serve(t, bus, fake)
+	defer provider.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for session.Path() == before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if session.Path() == before {
+		t.Fatalf("expected the session to be re-opened after the restart")
+	}
+
+	secret, err := kept.GetSecret(session.Path())
+	if err != nil {
+		t.Fatalf("surviving item: %s", err)
+	}
+
+	if secret.Value.Reveal() != "hunter2" {
+		t.Errorf("surviving item returned a different secret")
+	}
+
+	if _, err := vanished.GetLabel(); !keyring.IsStale(err) {
+		t.Errorf("expected IsStale for the vanished item but got %v", err)
+	}
+
+	if err := session.Close(); err != nil {
+		t.Errorf("failed to close the re-opened session: %s", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// URIScheme is the scheme of secret URIs
+const URIScheme = "secret-service"
+
+// SecretURI references an item of the secret service. The following forms
+// are supported:
+//
+//	secret-service://alias/<alias>?key=value&...#label
+//	secret-service://collection/<collection-label>?key=value&...#label
+//	secret-service:///<collection-path>?key=value&...#label
+//	secret-service:///<item-path>
+//	secret-service://?key=value&...#label
+//
+// The query holds the attributes and the optional fragment the label of
+// the item. The last form searches all collections
+type SecretURI struct {
+	// Alias is set if the collection is referenced by its alias
+	Alias string
+
+	// CollectionLabel is set if the collection is referenced by its label
+	CollectionLabel string
+
+	// Path is the object path of the item or collection
+	Path dbus.ObjectPath
+
+	// Attributes of the item
+	Attributes map[string]string
+
+	// Label of the item
+	Label string
+}
+
+// ParseURI parses a secret URI. See SecretURI for the supported forms
+func ParseURI(uri string) (*SecretURI, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != URIScheme {
+		return nil, fmt.Errorf("invalid secret URI %q: unsupported scheme %q", uri, u.Scheme)
+	}
+
+	ref := &SecretURI{
+		Label:      u.Fragment,
+		Attributes: make(map[string]string),
+	}
+
+	for k, v := range u.Query() {
+		if len(v) != 1 {
+			return nil, fmt.Errorf("invalid secret URI %q: attribute %q specified %d times", uri, k, len(v))
+		}
+		ref.Attributes[k] = v[0]
+	}
+
+	name := strings.TrimPrefix(u.Path, "/")
+
+	switch u.Host {
+	case "":
+		if u.Path != "" {
+			ref.Path = dbus.ObjectPath(u.Path)
+			if !ref.Path.IsValid() {
+				return nil, fmt.Errorf("invalid secret URI %q: invalid object path", uri)
+			}
+		}
+	case "alias":
+		ref.Alias = name
+	case "collection":
+		ref.CollectionLabel = name
+	default:
+		return nil, fmt.Errorf("invalid secret URI %q: unsupported host %q", uri, u.Host)
+	}
+
+	if (u.Host != "" && name == "") || (ref.Path == "" && u.Host == "" && len(ref.Attributes) == 0 && ref.Label == "") {
+		return nil, fmt.Errorf("invalid secret URI %q: no item referenced", uri)
+	}
+
+	return ref, nil
+}
+
+// String returns the URI representation of ref
+func (ref *SecretURI) String() string {
+	u := url.URL{
+		Scheme:   URIScheme,
+		Fragment: ref.Label,
+	}
+
+	switch {
+	case ref.Alias != "":
+		u.Host = "alias"
+		u.Path = "/" + ref.Alias
+	case ref.CollectionLabel != "":
+		u.Host = "collection"
+		u.Path = "/" + ref.CollectionLabel
+	default:
+		u.Path = string(ref.Path)
+	}
+
+	if len(ref.Attributes) > 0 {
+		values := url.Values{}
+		for k, v := range ref.Attributes {
+			values.Set(k, v)
+		}
+		u.RawQuery = values.Encode()
+	}
+
+	// url.URL drops the empty authority for path-only URIs
+	s := u.String()
+	if u.Host == "" && !strings.HasPrefix(s, URIScheme+"://") {
+		s = URIScheme + "://" + strings.TrimPrefix(s, URIScheme+":")
+	}
+
+	return s
+}
+
+// isItemPath returns true if ref directly references an item
+func (ref *SecretURI) isItemPath() bool {
+	return ref.Path != "" && len(ref.Attributes) == 0 && ref.Label == ""
+}
+
+// ResolveItem returns the single item referenced by uri. If more than one item
+// matches an *AmbiguousMatchError is returned
+func ResolveItem(ctx context.Context, svc SecretService, uri string) (Item, error) {
+	ref, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref.isItemPath() {
+		return svc.GetItemByPath(ref.Path)
+	}
+
+	var items []Item
+
+	q := &Query{
+		Attributes: ref.Attributes,
+	}
+
+	var col Collection
+	switch {
+	case ref.Alias != "":
+		col, err = svc.GetCollectionByAlias(ref.Alias)
+	case ref.CollectionLabel != "":
+		col, err = svc.GetCollection(ref.CollectionLabel)
+	case ref.Path != "":
+		col, err = svc.GetCollectionByPath(ref.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if col != nil {
+		items, err = col.Query(q)
+	} else {
+		items, err = svc.Query(q)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Item
+	for _, i := range items {
+		if ref.Label != "" {
+			l, err := i.GetLabel()
+			if err != nil {
+				return nil, err
+			}
+
+			if l != ref.Label {
+				continue
+			}
+		}
+
+		matches = append(matches, i)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, ErrNoSuchItem
+	case 1:
+		return matches[0], nil
+	}
+
+	return nil, &AmbiguousMatchError{
+		Attributes: ref.Attributes,
+		Matches:    len(matches),
+	}
+}
+
+// Resolve returns the secret referenced by uri. The item is unlocked if
+// required. See SecretURI for the supported forms
+func Resolve(ctx context.Context, svc SecretService, uri string) (*Secret, error) {
+	item, err := ResolveItem(ctx, svc, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := item.Locked()
+	if err != nil {
+		return nil, err
+	}
+
+	if locked {
+		if _, err := svc.Unlock([]dbus.ObjectPath{item.Path()}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	session, err := svc.OpenSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	return item.GetSecret(session.Path())
+}
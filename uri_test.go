@@ -0,0 +1,107 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseURI(t *testing.T) {
+	cases := []struct {
+		uri      string
+		expected *SecretURI
+	}{
+		{
+			uri: "secret-service://alias/default?service=db&user=app#label",
+			expected: &SecretURI{
+				Alias:      "default",
+				Attributes: map[string]string{"service": "db", "user": "app"},
+				Label:      "label",
+			},
+		},
+		{
+			uri: "secret-service://collection/Login?service=db",
+			expected: &SecretURI{
+				CollectionLabel: "Login",
+				Attributes:      map[string]string{"service": "db"},
+			},
+		},
+		{
+			uri: "secret-service://collection/My%20Secrets#with%20space",
+			expected: &SecretURI{
+				CollectionLabel: "My Secrets",
+				Attributes:      map[string]string{},
+				Label:           "with space",
+			},
+		},
+		{
+			uri: "secret-service:///org/freedesktop/secrets/collection/login/7",
+			expected: &SecretURI{
+				Path:       "/org/freedesktop/secrets/collection/login/7",
+				Attributes: map[string]string{},
+			},
+		},
+		{
+			uri: "secret-service://?service=db&user=a%26b",
+			expected: &SecretURI{
+				Attributes: map[string]string{"service": "db", "user": "a&b"},
+			},
+		},
+		{
+			uri: "secret-service://#label",
+			expected: &SecretURI{
+				Attributes: map[string]string{},
+				Label:      "label",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.uri, func(t *testing.T) {
+			ref, err := ParseURI(c.uri)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(ref, c.expected) {
+				t.Fatalf("expected %+v but got %+v", c.expected, ref)
+			}
+
+			if s := ref.String(); s != c.uri {
+				t.Errorf("expected String to return %q but got %q", c.uri, s)
+			}
+
+			again, err := ParseURI(ref.String())
+			if err != nil {
+				t.Fatalf("failed to parse %q: %s", ref.String(), err)
+			}
+
+			if !reflect.DeepEqual(again, ref) {
+				t.Errorf("round-trip changed %+v to %+v", ref, again)
+			}
+		})
+	}
+}
+
+func TestParseURIErrors(t *testing.T) {
+	cases := []string{
+		"https://alias/default",
+		"secret-service://alias/",
+		"secret-service://collection",
+		"secret-service://unknown/default",
+		"secret-service://",
+		"secret-service:///not//valid",
+		"secret-service://?service=a&service=b",
+		"secret-service://%zz",
+	}
+
+	for _, uri := range cases {
+		t.Run(uri, func(t *testing.T) {
+			if ref, err := ParseURI(uri); err == nil {
+				t.Errorf("expected an error but got %+v", ref)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// connWrapper is embedded by busConns wrapping another busConn. It forwards
+// all methods, including sessionTracker, to the wrapped connection
+type connWrapper struct {
+	busConn
+}
+
+// trackSession implements sessionTracker if the wrapped connection does
+func (w connWrapper) trackSession(s *session) {
+	if t, ok := w.busConn.(sessionTracker); ok {
+		t.trackSession(s)
+	}
+}
+
+// untrackSession implements sessionTracker if the wrapped connection does
+func (w connWrapper) untrackSession(s *session) {
+	if t, ok := w.busConn.(sessionTracker); ok {
+		t.untrackSession(s)
+	}
+}
+
+// unwrap returns the wrapped connection
+func (w connWrapper) unwrap() busConn {
+	return w.busConn
+}
+
+// wrappedConn is implemented by busConns wrapping another busConn
+type wrappedConn interface {
+	unwrap() busConn
+}
+
+// closeNotifier is implemented by connections that call functions once they
+// are closed
+type closeNotifier interface {
+	onClose(fn func())
+}
+
+// walkConn calls fn for conn and the connections wrapped by it, from the
+// outermost to the innermost, until fn returns true
+func walkConn(conn busConn, fn func(c busConn) bool) {
+	for !fn(conn) {
+		w, ok := conn.(wrappedConn)
+		if !ok {
+			return
+		}
+		conn = w.unwrap()
+	}
+}
+
+// notifyClose registers fn to be called once the innermost connection of conn
+// is closed if it supports it
+func notifyClose(conn busConn, fn func()) {
+	walkConn(conn, func(c busConn) bool {
+		n, ok := c.(closeNotifier)
+		if ok {
+			n.onClose(fn)
+		}
+		return ok
+	})
+}
+
+// callFunc is the signature of (dbus.BusObject).CallWithContext
+type callFunc func(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call
+
+// busObject is embedded by dbus.BusObjects wrapping another one. Call,
+// GetProperty and SetProperty are implemented using call, which is set to
+// the CallWithContext of the embedding object, so that wrappers only need to
+// implement CallWithContext
+type busObject struct {
+	dbus.BusObject
+	call callFunc
+}
+
+// Call implements dbus.BusObject
+func (o *busObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	return o.call(context.Background(), method, flags, args...)
+}
+
+// GetProperty implements dbus.BusObject
+func (o *busObject) GetProperty(p string) (dbus.Variant, error) {
+	return getProperty(o.call, p)
+}
+
+// SetProperty implements dbus.BusObject
+func (o *busObject) SetProperty(p string, v interface{}) error {
+	return setProperty(o.call, p, v)
+}
+
+// getProperty reads the property p in interface.member notation using call
+func getProperty(call callFunc, p string) (dbus.Variant, error) {
+	iface, prop, err := splitProperty(p)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+
+	var result dbus.Variant
+	if err := call(context.Background(), propertiesGet, 0, iface, prop).Store(&result); err != nil {
+		return dbus.Variant{}, err
+	}
+
+	return result, nil
+}
+
+// setProperty sets the property p in interface.member notation using call.
+// v is sent as a variant as required by org.freedesktop.DBus.Properties.Set
+func setProperty(call callFunc, p string, v interface{}) error {
+	iface, prop, err := splitProperty(p)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := v.(dbus.Variant); !ok {
+		v = dbus.MakeVariant(v)
+	}
+
+	return call(context.Background(), propertiesSet, 0, iface, prop, v).Err
+}
+
+// splitProperty splits a property name in interface.member notation
+func splitProperty(p string) (string, string, error) {
+	idx := strings.LastIndex(p, ".")
+	if idx <= 0 || idx+1 == len(p) {
+		return "", "", fmt.Errorf("invalid property %q", p)
+	}
+
+	return p[:idx], p[idx+1:], nil
+}
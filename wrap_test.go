@@ -0,0 +1,96 @@
+// Copyright 2019 Patrick Pacher. All rights reserved. Use of
+// this source code is governed by the included Simplified BSD license.
+
+package keyring
+
+import (
+	"context"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// sentBody records the arguments of the last method call. SetProperty sends
+// its arguments unchanged like (*dbus.Object).SetProperty does
+type sentBody struct {
+	dbus.BusObject
+
+	method string
+	args   []interface{}
+}
+
+func (o *sentBody) CallWithContext(ctx context.Context, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	o.method = method
+	o.args = args
+
+	return &dbus.Call{}
+}
+
+func (o *sentBody) SetProperty(p string, v interface{}) error {
+	iface, prop, err := splitProperty(p)
+	if err != nil {
+		return err
+	}
+
+	return o.CallWithContext(context.Background(), propertiesSet, 0, iface, prop, v).Err
+}
+
+// signature returns the signature of the recorded message body
+func (o *sentBody) signature() string {
+	return dbus.SignatureOf(o.args...).String()
+}
+
+func TestSetPropertySignature(t *testing.T) {
+	cases := []struct {
+		name string
+		set  func(obj dbus.BusObject) error
+	}{
+		{
+			name: "setProperty",
+			set: func(obj dbus.BusObject) error {
+				return setProperty(obj.CallWithContext, itemPropLabel, "db")
+			},
+		},
+		{
+			name: "setProperty with variant",
+			set: func(obj dbus.BusObject) error {
+				return setProperty(obj.CallWithContext, itemPropLabel, dbus.MakeVariant("db"))
+			},
+		},
+		{
+			name: "item label",
+			set: func(obj dbus.BusObject) error {
+				return (&item{obj: obj}).SetLabel("db")
+			},
+		},
+		{
+			name: "item attributes",
+			set: func(obj dbus.BusObject) error {
+				return (&item{obj: obj}).SetAttributes(map[string]string{"service": "db"})
+			},
+		},
+		{
+			name: "collection label",
+			set: func(obj dbus.BusObject) error {
+				return (&collection{obj: obj}).SetLabel("work")
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			obj := &sentBody{}
+			if err := c.set(obj); err != nil {
+				t.Fatal(err)
+			}
+
+			if obj.method != propertiesSet {
+				t.Errorf("expected a call to %s but got %s", propertiesSet, obj.method)
+			}
+
+			if sig := obj.signature(); sig != "ssv" {
+				t.Errorf("expected signature ssv but got %s", sig)
+			}
+		})
+	}
+}